@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"quill/internal/jsonapi"
+	"quill/internal/parser"
 	"sync"
 	"unsafe"
 )
@@ -34,6 +36,38 @@ func quill_new_interpreter(source *C.char) C.int {
 	return C.int(id)
 }
 
+// quill_new_interpreter_with_files creates an interpreter for a script split
+// across several files. files is a JSON object mapping file paths to their
+// source and main is the path of the file to run.
+//
+//export quill_new_interpreter_with_files
+func quill_new_interpreter_with_files(mainFile *C.char, filesJSON *C.char) C.int {
+	var files map[string]string
+	if err := json.Unmarshal([]byte(C.GoString(filesJSON)), &files); err != nil {
+		return -1
+	}
+
+	goMain := C.GoString(mainFile)
+	source, exists := files[goMain]
+	if !exists {
+		return -1
+	}
+
+	interp, _ := jsonapi.NewQuillInterpreterWithLoader(goMain, source, parser.MapLoader(files))
+
+	if interp == nil {
+		return -1
+	}
+
+	mu.Lock()
+	id := nextID
+	interpreters[nextID] = interp
+	nextID++
+	mu.Unlock()
+
+	return C.int(id)
+}
+
 //export quill_step
 func quill_step(interpID C.int) *C.char {
 	mu.Lock()
@@ -153,6 +187,30 @@ func quill_parse_only(source *C.char) *C.char {
 	return cResult
 }
 
+// quill_parse_only_with_files parses a script split across several files, see
+// quill_new_interpreter_with_files for the arguments
+//
+//export quill_parse_only_with_files
+func quill_parse_only_with_files(mainFile *C.char, filesJSON *C.char) *C.char {
+	var files map[string]string
+	if err := json.Unmarshal([]byte(C.GoString(filesJSON)), &files); err != nil {
+		return C.CString(`{"success":false,"error":"Invalid files JSON"}`)
+	}
+
+	goMain := C.GoString(mainFile)
+	source, exists := files[goMain]
+	if !exists {
+		return C.CString(`{"success":false,"error":"Main file not found in files"}`)
+	}
+
+	result := jsonapi.ParseOnlyWithLoader(goMain, source, parser.MapLoader(files))
+	cResult := C.CString(result)
+	if cResult == nil {
+		return C.CString(`{"success":false,"error":"Failed to allocate C string"}`)
+	}
+	return cResult
+}
+
 //export quill_handle_tool_call_response
 func quill_handle_tool_call_response(interpID C.int, responseJSON *C.char) *C.char {
 	mu.Lock()
@@ -163,13 +221,66 @@ func quill_handle_tool_call_response(interpID C.int, responseJSON *C.char) *C.ch
 		return C.CString(`{"success":false,"error":"Invalid interpreter ID"}`)
 	}
 
-	// Parse the JSON response to extract the actual result
+	// The response is decoded from JSON, so strings have to be quoted
 	goResponseJSON := C.GoString(responseJSON)
+	result := interp.HandleToolCallResponseJSON(goResponseJSON)
+	cResult := C.CString(result)
+	if cResult == nil {
+		return C.CString(`{"success":false,"error":"Failed to allocate C string"}`)
+	}
+	return cResult
+}
+
+// quill_seed resets the random number generator used by RANDOM blocks, so a
+// run can be replayed with the same seed and choices
+//
+//export quill_seed
+func quill_seed(interpID C.int, seed C.ulonglong) *C.char {
+	mu.Lock()
+	interp, exists := interpreters[int(interpID)]
+	mu.Unlock()
+
+	if !exists {
+		return C.CString(`{"success":false,"error":"Invalid interpreter ID"}`)
+	}
+
+	result := interp.Seed(uint64(seed))
+	cResult := C.CString(result)
+	if cResult == nil {
+		return C.CString(`{"success":false,"error":"Failed to allocate C string"}`)
+	}
+	return cResult
+}
+
+//export quill_save
+func quill_save(interpID C.int) *C.char {
+	mu.Lock()
+	interp, exists := interpreters[int(interpID)]
+	mu.Unlock()
+
+	if !exists {
+		return C.CString(`{"success":false,"error":"Invalid interpreter ID"}`)
+	}
+
+	result := interp.Save()
+	cResult := C.CString(result)
+	if cResult == nil {
+		return C.CString(`{"success":false,"error":"Failed to allocate C string"}`)
+	}
+	return cResult
+}
+
+//export quill_load
+func quill_load(interpID C.int, snapshotJSON *C.char) *C.char {
+	mu.Lock()
+	interp, exists := interpreters[int(interpID)]
+	mu.Unlock()
+
+	if !exists {
+		return C.CString(`{"success":false,"error":"Invalid interpreter ID"}`)
+	}
 
-	// For now, we'll pass the JSON string directly to the interpreter
-	// In a more sophisticated implementation, you might want to parse this JSON
-	// and extract the actual value based on type
-	result := interp.HandleToolCallResponse(goResponseJSON)
+	result := interp.Load(C.GoString(snapshotJSON))
 	cResult := C.CString(result)
 	if cResult == nil {
 		return C.CString(`{"success":false,"error":"Failed to allocate C string"}`)
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"quill/internal/ast"
+	"quill/internal/explorer"
+	"quill/internal/interpreter"
+	"quill/internal/playtest"
+	"slices"
+	"strings"
+)
+
+type CoverageArgs struct {
+	Files    []string
+	Annotate bool
+}
+
+func parseCoverageArgs(arguments []string) (CoverageArgs, error) {
+	flags := flag.NewFlagSet("coverage", flag.ContinueOnError)
+
+	var annotate bool
+	flags.BoolVar(&annotate, "annotate", false, "Print the scripts with the number of times each statement ran")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: quill coverage [options] <test file or directory>...\n")
+		fmt.Fprintln(os.Stderr, "Plays test files like quill test and reports which statements of their scripts ran,")
+		fmt.Fprintln(os.Stderr, "directories are searched for .test.json files.")
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return CoverageArgs{}, err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return CoverageArgs{}, fmt.Errorf("no test files given")
+	}
+
+	return CoverageArgs{
+		Files:    flags.Args(),
+		Annotate: annotate,
+	}, nil
+}
+
+// runCoverage plays the given test files and returns the exit status: 1 if
+// a test could not be played as recorded
+func runCoverage(arguments []string) int {
+	args, err := parseCoverageArgs(arguments)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	files, err := findFiles(args.Files, ".test.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding files: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	coverage := make(explorer.Coverage)
+	var scripts []string
+	for _, file := range files {
+		test, err := playtest.Load(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		// Coverage of a failing test is reported too, but only up to where it failed
+		result := playtest.Run(file, test, interpreter.WithTrace(coverage.Add))
+		if !result.Passed(test) {
+			fmt.Fprintf(os.Stderr, "Test %s does not pass, run quill test for details\n", file)
+			status = 1
+		}
+
+		script := test.ScriptFile(file)
+		if !slices.Contains(scripts, script) {
+			scripts = append(scripts, script)
+		}
+	}
+
+	for _, script := range scripts {
+		program, ok := parseScript(script)
+		if !ok {
+			status = 1
+			continue
+		}
+
+		statements := explorer.Statements(program)
+		covered := 0
+		for _, stmt := range statements {
+			if coverage[explorer.PositionOf(stmt)] > 0 {
+				covered++
+			}
+		}
+		percent := 100.0
+		if len(statements) > 0 {
+			percent = float64(covered) * 100 / float64(len(statements))
+		}
+		fmt.Printf("%s: %d of %d statements covered (%.1f%%)\n", script, covered, len(statements), percent)
+
+		if args.Annotate {
+			annotate(statements, coverage)
+			continue
+		}
+		for _, span := range coverage.Unreached(program) {
+			fmt.Printf("  %s never run\n", describeSpan(span))
+		}
+	}
+
+	return status
+}
+
+// annotate prints the files of a script with the number of times the first
+// statement on each line ran
+func annotate(statements []ast.Statement, coverage explorer.Coverage) {
+	var files []string
+	counts := make(map[string]map[int]int)
+	for _, stmt := range statements {
+		at := ast.StatementToken(stmt)
+		if counts[at.File] == nil {
+			files = append(files, at.File)
+			counts[at.File] = make(map[int]int)
+		}
+		if _, exists := counts[at.File][at.Line]; !exists {
+			counts[at.File][at.Line] = coverage[explorer.PositionOf(stmt)]
+		}
+	}
+
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
+			continue
+		}
+
+		fmt.Printf("\n%s:\n", file)
+		for idx, line := range strings.Split(strings.TrimSuffix(string(source), "\n"), "\n") {
+			count, isStatement := counts[file][idx+1]
+			switch {
+			case !isStatement:
+				fmt.Printf("%8s | %s\n", "", line)
+			case count == 0:
+				fmt.Printf("%8s | %s\n", "#####", line)
+			default:
+				fmt.Printf("%8d | %s\n", count, line)
+			}
+		}
+	}
+}
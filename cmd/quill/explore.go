@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"quill/internal/ast"
+	"quill/internal/explorer"
+	"quill/internal/interpreter"
+	"quill/internal/parser"
+	"quill/internal/playtest"
+	"quill/internal/scanner"
+	"strings"
+)
+
+type ExploreArgs struct {
+	File      string
+	Snapshot  string
+	Tools     string
+	Seed      uint64
+	MaxStates int
+}
+
+func parseExploreArgs(arguments []string) (ExploreArgs, error) {
+	flags := flag.NewFlagSet("explore", flag.ContinueOnError)
+
+	var snapshot string
+	flags.StringVar(&snapshot, "snapshot", "", "Start from a snapshot saved with the JSON API instead of the start of the script")
+
+	var tools string
+	flags.StringVar(&tools, "tools", "", "JSON file with the results tool calls may return, as in test files")
+
+	var seed uint64
+	flags.Uint64Var(&seed, "seed", 0, "Seed for SHUFFLE blocks")
+
+	var maxStates int
+	flags.IntVar(&maxStates, "max-states", explorer.DefaultMaxStates, "Stop after this many distinct states")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: quill explore [options] <file>\n")
+		fmt.Fprintln(os.Stderr, "Follows every choice, RANDOM option and tool call result of a script and reports")
+		fmt.Fprintln(os.Stderr, "unreachable code, loops without a way out, paths without END and runtime errors.")
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return ExploreArgs{}, err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return ExploreArgs{}, fmt.Errorf("expected one script file")
+	}
+	if maxStates < 1 {
+		return ExploreArgs{}, fmt.Errorf("-max-states must be at least 1")
+	}
+
+	return ExploreArgs{
+		File:      flags.Arg(0),
+		Snapshot:  snapshot,
+		Tools:     tools,
+		Seed:      seed,
+		MaxStates: maxStates,
+	}, nil
+}
+
+// runExplore explores a script and returns the exit status: 1 if anything
+// was found
+func runExplore(arguments []string) int {
+	args, err := parseExploreArgs(arguments)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	program, ok := parseScript(args.File)
+	if !ok {
+		return 1
+	}
+
+	options := explorer.Options{
+		Seed:      args.Seed,
+		MaxStates: args.MaxStates,
+	}
+	if args.Tools != "" {
+		options.Tools, err = playtest.LoadTools(args.Tools)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading tools: %v\n", err)
+			return 1
+		}
+	}
+	if args.Snapshot != "" {
+		options.Start, err = loadSnapshot(args.Snapshot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading snapshot %s: %v\n", args.Snapshot, err)
+			return 1
+		}
+	}
+
+	report, err := explorer.Explore(program, options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exploring %s: %v\n", args.File, err)
+		return 1
+	}
+
+	statements := explorer.Statements(program)
+	reached := 0
+	for _, stmt := range statements {
+		if report.Coverage[explorer.PositionOf(stmt)] > 0 {
+			reached++
+		}
+	}
+	fmt.Printf("Explored %d states, %d of %d statements reached\n", report.States, reached, len(statements))
+	if report.Merged {
+		fmt.Printf("VISITS or TURNS counts above %d were treated as equal, code reported as unreachable may still be reached.\n", explorer.CountLimit)
+	} else if !report.Complete {
+		fmt.Printf("Stopped after %d states, code reported as unreachable may still be reached. Raise -max-states to explore further.\n", args.MaxStates)
+	}
+
+	found := len(report.Unreached) > 0
+	if len(report.Unreached) > 0 {
+		fmt.Println("\nUnreachable code:")
+		for _, span := range report.Unreached {
+			fmt.Printf("  %s never reached\n", describeSpan(span))
+		}
+	}
+
+	sections := []struct {
+		title    string
+		findings []explorer.Finding
+	}{
+		{"Unreachable labels", report.Labels},
+		{"Loops without a way out", report.Loops},
+		{"Paths ending without END", report.OpenEnds},
+		{"Runtime errors", report.Errors},
+		{"Tool calls without a stub", report.MissingTools},
+	}
+	for _, section := range sections {
+		if len(section.findings) == 0 {
+			continue
+		}
+		found = true
+
+		fmt.Printf("\n%s:\n", section.title)
+		for _, finding := range section.findings {
+			fmt.Printf("  %s:%d:%d: %s\n", finding.File, finding.Line, finding.Column, finding.Message)
+			if finding.Path != nil {
+				fmt.Printf("    after: %s\n", describePath(finding.Path))
+			}
+		}
+	}
+
+	if found {
+		return 1
+	}
+	return 0
+}
+
+// describeSpan writes where a span is and how many statements it holds
+func describeSpan(span explorer.Span) string {
+	lines := fmt.Sprintf("%s:%d", span.File, span.Line)
+	if span.EndLine > span.Line {
+		lines += fmt.Sprintf("-%d", span.EndLine)
+	}
+	if span.Statements == 1 {
+		return lines + ": 1 statement is"
+	}
+	return fmt.Sprintf("%s: %d statements are", lines, span.Statements)
+}
+
+func describePath(path []string) string {
+	if len(path) == 0 {
+		return "starting the script"
+	}
+	return strings.Join(path, " > ")
+}
+
+// parseScript reads and parses a script, printing its errors
+func parseScript(file string) (*ast.Program, bool) {
+	fileContent, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
+		return nil, false
+	}
+
+	tokens, scannerErrors := scanner.NewWithFile(string(fileContent), file).ScanTokens()
+	scriptParser := parser.NewWithLoader(tokens, parser.FileLoader)
+	program, parserErrors := scriptParser.Parse()
+	scannerErrors = append(scannerErrors, scriptParser.ScannerErrors()...)
+
+	for _, err := range scannerErrors {
+		fmt.Fprintf(os.Stderr, "ScannerError in %s at line %d, column %d: %s\n", err.File, err.Line, err.Column, err.Message)
+	}
+	for _, err := range parserErrors {
+		fmt.Fprintf(os.Stderr, "ParseError in %s at line %d, column %d: %s\n", err.File, err.Line, err.Column, err.Message)
+	}
+	return program, len(scannerErrors) == 0 && len(parserErrors) == 0
+}
+
+// loadSnapshot reads a snapshot, either the whole result of the JSON API's
+// Save or only its data
+func loadSnapshot(file string) (*interpreter.Snapshot, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := json.RawMessage(content)
+	var envelope struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err == nil && envelope.Type == "snapshot" {
+		raw = envelope.Data
+	}
+
+	var snapshot interpreter.Snapshot
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
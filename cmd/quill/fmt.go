@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"quill/internal/formatter"
+	"strings"
+)
+
+type FmtArgs struct {
+	Files   []string
+	Check   bool
+	InPlace bool
+}
+
+func parseFmtArgs(arguments []string) (FmtArgs, error) {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+
+	var check bool
+	flags.BoolVar(&check, "c", false, "Check only, list files that are not formatted and exit with status 1")
+
+	var inPlace bool
+	flags.BoolVar(&inPlace, "w", false, "Write the formatted source back to the files")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: quill fmt [options] <file or directory>...\n")
+		fmt.Fprintln(os.Stderr, "Formats Quill scripts, directories are searched for .q files.")
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return FmtArgs{}, err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return FmtArgs{}, fmt.Errorf("no files given")
+	}
+	if check && inPlace {
+		return FmtArgs{}, fmt.Errorf("-c and -w cannot be used together")
+	}
+
+	return FmtArgs{
+		Files:   flags.Args(),
+		Check:   check,
+		InPlace: inPlace,
+	}, nil
+}
+
+// runFmt formats the given files and returns the exit status: 1 if a file
+// could not be formatted, or in check mode is not formatted
+func runFmt(arguments []string) int {
+	args, err := parseFmtArgs(arguments)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	files, err := findFiles(args.Files, ".q")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding files: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	for _, file := range files {
+		if !formatFile(file, args) {
+			status = 1
+		}
+	}
+	return status
+}
+
+// findFiles expands directories to the files inside them whose name ends
+// with suffix
+func findFiles(paths []string, suffix string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, suffix) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func formatFile(file string, args FmtArgs) bool {
+	fileContent, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
+		return false
+	}
+	source := string(fileContent)
+
+	formatted, scannerErrors, parserErrors := formatter.Source(file, source)
+	for _, err := range scannerErrors {
+		fmt.Fprintf(os.Stderr, "ScannerError in %s at line %d, column %d: %s\n", err.File, err.Line, err.Column, err.Message)
+	}
+	for _, err := range parserErrors {
+		fmt.Fprintf(os.Stderr, "ParseError in %s at line %d, column %d: %s\n", err.File, err.Line, err.Column, err.Message)
+	}
+	if len(scannerErrors) > 0 || len(parserErrors) > 0 {
+		return false
+	}
+
+	switch {
+	case args.Check:
+		if formatted != source {
+			fmt.Println(file)
+			return false
+		}
+	case args.InPlace:
+		if formatted != source {
+			if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing file %s: %v\n", file, err)
+				return false
+			}
+		}
+	default:
+		fmt.Print(formatted)
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"quill/internal/graph"
+)
+
+type GraphArgs struct {
+	File   string
+	Format string
+	Output string
+}
+
+func parseGraphArgs(arguments []string) (GraphArgs, error) {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+
+	var format string
+	flags.StringVar(&format, "format", "dot", "Output format, dot for Graphviz or mermaid")
+
+	var output string
+	flags.StringVar(&output, "o", "", "Write the graph to a file instead of standard output")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: quill graph [options] <file>\n")
+		fmt.Fprintln(os.Stderr, "Exports the flow between labels, choices, RANDOM blocks and scenes of a script.")
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return GraphArgs{}, err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return GraphArgs{}, fmt.Errorf("expected one script file")
+	}
+	if format != "dot" && format != "mermaid" {
+		return GraphArgs{}, fmt.Errorf("unknown format %q, use dot or mermaid", format)
+	}
+
+	return GraphArgs{
+		File:   flags.Arg(0),
+		Format: format,
+		Output: output,
+	}, nil
+}
+
+// runGraph exports the flow graph of a script and returns the exit status
+func runGraph(arguments []string) int {
+	args, err := parseGraphArgs(arguments)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	program, ok := parseScript(args.File)
+	if !ok {
+		return 1
+	}
+
+	flow := graph.Build(program, args.File)
+	output := flow.DOT()
+	if args.Format == "mermaid" {
+		output = flow.Mermaid()
+	}
+
+	if args.Output == "" {
+		fmt.Print(output)
+		return 0
+	}
+	if err := os.WriteFile(args.Output, []byte(output), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing file %s: %v\n", args.Output, err)
+		return 1
+	}
+	return 0
+}
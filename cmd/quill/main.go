@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"math/rand/v2"
 	"os"
+	"quill/internal/checker"
 	"quill/internal/interpreter"
+	"quill/internal/lsp"
 	"quill/internal/parser"
 	"quill/internal/scanner"
 	"strconv"
@@ -16,16 +19,40 @@ type Args struct {
 	File      string
 	Verbose   bool
 	ParseOnly bool
+	Seed      uint64
+	HasSeed   bool // -seed was given, 0 is a seed like any other
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "test":
+			os.Exit(runTests(os.Args[2:]))
+		case "explore":
+			os.Exit(runExplore(os.Args[2:]))
+		case "coverage":
+			os.Exit(runCoverage(os.Args[2:]))
+		case "graph":
+			os.Exit(runGraph(os.Args[2:]))
+		case "lsp":
+			// The language server talks to the editor over stdin and stdout
+			if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+				fmt.Fprintf(os.Stderr, "Language server error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	args, err := parseArgs()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		os.Exit(1)
 	}
 
-	runFile(args.File, args)
+	os.Exit(runFile(args.File, args))
 }
 
 func parseArgs() (Args, error) {
@@ -35,14 +62,28 @@ func parseArgs() (Args, error) {
 	var parseOnly bool
 	flag.BoolVar(&parseOnly, "p", false, "Parse only, do not run the program")
 
+	var seed uint64
+	flag.Uint64Var(&seed, "seed", 0, "Seed for RANDOM blocks, a random seed is used if not given")
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: quill [options] [file]\n")
+		fmt.Fprintf(os.Stderr, "       quill fmt [options] <file or directory>...\n")
+		fmt.Fprintf(os.Stderr, "       quill test [options] <test file or directory>...\n")
+		fmt.Fprintf(os.Stderr, "       quill explore [options] <file>\n")
+		fmt.Fprintf(os.Stderr, "       quill coverage [options] <test file or directory>...\n")
+		fmt.Fprintf(os.Stderr, "       quill graph [options] <file>\n")
+		fmt.Fprintf(os.Stderr, "       quill lsp\n")
 		fmt.Fprintln(os.Stderr, "Options:")
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
+	hasSeed := false
+	flag.Visit(func(f *flag.Flag) {
+		hasSeed = hasSeed || f.Name == "seed"
+	})
+
 	args := flag.Args()
 
 	var file string
@@ -54,27 +95,29 @@ func parseArgs() (Args, error) {
 		File:      file,
 		Verbose:   verbose,
 		ParseOnly: parseOnly,
+		Seed:      seed,
+		HasSeed:   hasSeed,
 	}, nil
 }
 
-func runFile(file string, args Args) {
+// runFile runs a script and returns the exit status: 1 if it could not be
+// read or has errors
+func runFile(file string, args Args) int {
 	fileContent, err := os.ReadFile(file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", file, err)
-		return
+		return 1
 	}
-	run(string(fileContent), args)
+	return run(file, string(fileContent), args)
 }
 
-func run(source string, args Args) {
-	scanner := scanner.New(source)
+func run(file string, source string, args Args) int {
+	scanner := scanner.NewWithFile(source, file)
 	tokens, scannerErrors := scanner.ScanTokens()
 
-	if len(scannerErrors) > 0 {
-		for _, err := range scannerErrors {
-			fmt.Fprintf(os.Stderr, "ScannerError at line %d: %s\n", err.Line, err.Message)
-		}
-		return
+	// Parse even after scanner errors, so all errors of the file are reported at once
+	for _, err := range scannerErrors {
+		fmt.Fprintf(os.Stderr, "ScannerError in %s at line %d, column %d: %s\n", err.File, err.Line, err.Column, err.Message)
 	}
 
 	if args.Verbose {
@@ -88,14 +131,19 @@ func run(source string, args Args) {
 		}
 	}
 
-	parser := parser.New(tokens)
+	parser := parser.NewWithLoader(tokens, parser.FileLoader)
 	program, parserErrors := parser.Parse()
 
-	if len(parserErrors) > 0 {
-		for _, err := range parserErrors {
-			fmt.Fprintf(os.Stderr, "ParseError at line %d: %s\n", err.Line, err.Message)
-		}
-		return
+	// Scanner errors of included files are only known after parsing
+	scannerErrors = append(scannerErrors, parser.ScannerErrors()...)
+	for _, err := range parser.ScannerErrors() {
+		fmt.Fprintf(os.Stderr, "ScannerError in %s at line %d, column %d: %s\n", err.File, err.Line, err.Column, err.Message)
+	}
+	for _, err := range parserErrors {
+		fmt.Fprintf(os.Stderr, "ParseError in %s at line %d, column %d: %s\n", err.File, err.Line, err.Column, err.Message)
+	}
+	if len(scannerErrors) > 0 || len(parserErrors) > 0 {
+		return 1
 	}
 
 	fmt.Println("File parsed successfully.")
@@ -106,12 +154,41 @@ func run(source string, args Args) {
 	}
 
 	if args.ParseOnly {
+		// Parse only mode also checks the program for mistakes, warnings
+		// alone do not fail
+		diagnostics := checker.Check(program)
+		for _, diagnostic := range diagnostics {
+			fmt.Fprintf(os.Stderr, "%s in %s at line %d, column %d: %s\n", severityLabel(diagnostic.Severity), diagnostic.File, diagnostic.Line, diagnostic.Column, diagnostic.Message)
+		}
 		fmt.Println("Parse only mode, exiting after parsing.")
-		return
+		if checker.HasErrors(diagnostics) {
+			return 1
+		}
+		return 0
+	}
+
+	// Print the seed so a run can be replayed with -seed, on stderr to keep
+	// it out of the dialog
+	seed := args.Seed
+	if !args.HasSeed {
+		seed = rand.Uint64()
 	}
+	fmt.Fprintf(os.Stderr, "Random seed: %d\n", seed)
 
 	// Run the interpreter with the new result-based model
-	runInterpreter(interpreter.New(program))
+	runInterpreter(interpreter.New(program, interpreter.WithSeed(seed)))
+	return 0
+}
+
+func severityLabel(severity checker.Severity) string {
+	switch severity {
+	case checker.SeverityError:
+		return "Error"
+	case checker.SeverityWarning:
+		return "Warning"
+	default:
+		return "Info"
+	}
 }
 
 func runInterpreter(interp *interpreter.Interpreter) {
@@ -119,8 +196,15 @@ func runInterpreter(interp *interpreter.Interpreter) {
 
 	fmt.Println("-- Starting script execution ---")
 
-	for !interp.IsEnded() {
-		result := interp.Step()
+	// Results returned by choice and tool call handling are processed like steps
+	var next *interpreter.InterpreterResult
+
+	for !interp.IsEnded() || next != nil {
+		result := next
+		next = nil
+		if result == nil {
+			result = interp.Step()
+		}
 
 		switch result.Type {
 		case interpreter.DialogResult:
@@ -134,8 +218,8 @@ func runInterpreter(interp *interpreter.Interpreter) {
 		case interpreter.ChoiceResult:
 			data := result.Data.(interpreter.ChoiceData)
 			fmt.Println("\nChoices:")
-			for _, option := range data.Options {
-				fmt.Printf("%d. %s", option.Index+1, option.Text)
+			for idx, option := range data.Options {
+				fmt.Printf("%d. %s", idx+1, option.Text)
 				if len(option.Tags) > 0 {
 					fmt.Printf(" [%s]", strings.Join(option.Tags, ", "))
 				}
@@ -158,25 +242,8 @@ func runInterpreter(interp *interpreter.Interpreter) {
 					continue
 				}
 
-				// Handle the choice (convert from 1-based to 0-based index)
-				choiceResult := interp.HandleChoiceInput(choice - 1)
-				if choiceResult.Type == interpreter.ErrorResult {
-					errorData := choiceResult.Data.(interpreter.ErrorData)
-					fmt.Fprintf(os.Stderr, "Error: %s\n", errorData.Message)
-					return
-				}
-
-				// Process the result from handling the choice
-				if choiceResult.Type == interpreter.DialogResult {
-					dialogData := choiceResult.Data.(interpreter.DialogData)
-					fmt.Printf("%s: %s", dialogData.Character, dialogData.Text)
-					if len(dialogData.Tags) > 0 {
-						fmt.Printf(" [%s]", strings.Join(dialogData.Tags, ", "))
-					}
-					fmt.Println()
-				}
-				// Note: We don't handle other result types here as they'll be processed in the next loop iteration
-
+				// Handle the choice (the index of an option can differ from its position when options are hidden)
+				next = interp.HandleChoiceInput(data.Options[choice-1].Index)
 				break
 			}
 
@@ -190,25 +257,8 @@ func runInterpreter(interp *interpreter.Interpreter) {
 			fmt.Printf("Mock result: %v\n", mockResult)
 
 			// Send the result back to the interpreter
-			toolResult := interp.HandleToolCallResponse(mockResult)
-			if toolResult != nil {
-				if toolResult.Type == interpreter.ErrorResult {
-					errorData := toolResult.Data.(interpreter.ErrorData)
-					fmt.Fprintf(os.Stderr, "Error: %s\n", errorData.Message)
-					return
-				}
-
-				// Handle other result types if needed
-				if toolResult.Type == interpreter.DialogResult {
-					dialogData := toolResult.Data.(interpreter.DialogData)
-					fmt.Printf("%s: %s", dialogData.Character, dialogData.Text)
-					if len(dialogData.Tags) > 0 {
-						fmt.Printf(" [%s]", strings.Join(dialogData.Tags, ", "))
-					}
-					fmt.Println()
-				}
-			}
-			// If toolResult is nil, the LET statement completed and execution will continue in next loop iteration
+			// If it returns nil, the paused statement is run again on the next step
+			next = interp.HandleToolCallResponse(mockResult)
 
 		case interpreter.EndResult:
 			fmt.Println("\n--- End of script ---")
@@ -216,7 +266,7 @@ func runInterpreter(interp *interpreter.Interpreter) {
 
 		case interpreter.ErrorResult:
 			errorData := result.Data.(interpreter.ErrorData)
-			fmt.Fprintf(os.Stderr, "Runtime Error at line %d: %s\n", errorData.Line, errorData.Message)
+			fmt.Fprintf(os.Stderr, "Runtime Error at line %d, column %d: %s\n", errorData.Line, errorData.Column, errorData.Message)
 			return
 
 		default:
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"quill/internal/playtest"
+	"slices"
+)
+
+type TestArgs struct {
+	Files  []string
+	Update bool
+}
+
+func parseTestArgs(arguments []string) (TestArgs, error) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var update bool
+	flags.BoolVar(&update, "update", false, "Write the transcript of each playthrough into its test file")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: quill test [options] <test file or directory>...\n")
+		fmt.Fprintln(os.Stderr, "Plays scripts with the choices and tool responses of a test file and compares the transcript,")
+		fmt.Fprintln(os.Stderr, "directories are searched for .test.json files.")
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return TestArgs{}, err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return TestArgs{}, fmt.Errorf("no test files given")
+	}
+
+	return TestArgs{
+		Files:  flags.Args(),
+		Update: update,
+	}, nil
+}
+
+// runTests plays the given test files and returns the exit status: 1 if a
+// test failed
+func runTests(arguments []string) int {
+	args, err := parseTestArgs(arguments)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	files, err := findFiles(args.Files, ".test.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding files: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, file := range files {
+		if !runTest(file, args) {
+			failed++
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed\n", len(files)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runTest(file string, args TestArgs) bool {
+	test, err := playtest.Load(file)
+	if err != nil {
+		fmt.Printf("FAIL %s\n    %v\n", file, err)
+		return false
+	}
+
+	result := playtest.Run(file, test)
+
+	if args.Update && len(result.Failures) == 0 {
+		test.Transcript = result.Transcript
+		if err := playtest.Save(file, test); err != nil {
+			fmt.Printf("FAIL %s\n    Error writing file: %v\n", file, err)
+			return false
+		}
+		fmt.Printf("UPDATED %s\n", file)
+		return true
+	}
+
+	if result.Passed(test) {
+		fmt.Printf("PASS %s\n", file)
+		return true
+	}
+
+	fmt.Printf("FAIL %s\n", file)
+	for _, failure := range result.Failures {
+		fmt.Printf("    %s\n", failure)
+	}
+	if !slices.Equal(test.Transcript, result.Transcript) {
+		fmt.Println("    Transcript (- expected, + actual):")
+		for _, line := range playtest.Diff(test.Transcript, result.Transcript) {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	return false
+}
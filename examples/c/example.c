@@ -72,7 +72,12 @@ int main() {
         printf("Failed to create interpreter\n");
         return 1;
     }
-    printf("Created interpreter with ID: %d\n\n", interp_id);
+    printf("Created interpreter with ID: %d\n", interp_id);
+
+    // Seed the random number generator so RANDOM blocks can be replayed
+    char* seed_result = quill_seed(interp_id, 42);
+    printf("Seed result: %s\n\n", seed_result);
+    quill_free_string(seed_result);
 
     // Test interpreter methods
     printf("3. Testing interpreter methods:\n");
@@ -133,6 +138,18 @@ int main() {
         quill_free_string(step_result);
     }
 
+    // Save the state and load it into a fresh interpreter
+    printf("\n4. Testing save and load:\n");
+    char* snapshot = quill_save(interp_id);
+    printf("Save result: %s\n", snapshot);
+
+    int restored_id = quill_new_interpreter(source);
+    char* load_result = quill_load(restored_id, snapshot);
+    printf("Load result: %s\n", load_result);
+    quill_free_string(load_result);
+    quill_free_string(snapshot);
+    quill_free_interpreter(restored_id);
+
     // Clean up
     quill_free_interpreter(interp_id);
     
@@ -1,6 +1,9 @@
 package ast
 
-import "quill/internal/token"
+import (
+	"quill/internal/token"
+	"strings"
+)
 
 type Identifier struct {
 	Token token.Token
@@ -25,7 +28,33 @@ func (sl *StringLiteral) String() string {
 	if sl == nil {
 		return "<nil StringLiteral>"
 	}
-	return "\"" + sl.Value + "\""
+	return "\"" + EscapeText(sl.Value) + "\""
+}
+
+// EscapeText writes text so it reads back as the same string literal: quotes,
+// backslashes, newlines, tabs, braces and tool call brackets are escaped
+func EscapeText(text string) string {
+	var builder strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '"' || c == '\\' || c == '{':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c == '\n':
+			builder.WriteString("\\n")
+		case c == '\t':
+			builder.WriteString("\\t")
+		case c == '<' && i+1 < len(text) && isLetter(text[i+1]):
+			builder.WriteString("\\<")
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
 }
 
 type TagList struct {
@@ -83,6 +112,19 @@ func (il *IntegerLiteral) String() string {
 	return il.Token.Lexeme
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) String() string {
+	if fl == nil {
+		return "<nil FloatLiteral>"
+	}
+	return fl.Token.Lexeme
+}
+
 // Infix Expression (for operators like +, -, ==, >=, etc.)
 type InfixExpression struct {
 	Token    token.Token // the operator token
@@ -108,6 +150,67 @@ func (ie *InfixExpression) String() string {
 	return result
 }
 
+// List Literal (for [a, b, c])
+type ListLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (ll *ListLiteral) expressionNode() {}
+func (ll *ListLiteral) String() string {
+	if ll == nil {
+		return "<nil ListLiteral>"
+	}
+	elements := make([]string, 0, len(ll.Elements))
+	for _, element := range ll.Elements {
+		elements = append(elements, element.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Map Literal (for {"key": value}), keys are kept in source order
+type MapLiteral struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (ml *MapLiteral) expressionNode() {}
+func (ml *MapLiteral) String() string {
+	if ml == nil {
+		return "<nil MapLiteral>"
+	}
+	pairs := make([]string, 0, len(ml.Keys))
+	for idx, key := range ml.Keys {
+		pairs = append(pairs, key.String()+": "+ml.Values[idx].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Index Expression (for list[0] and map["key"])
+type IndexExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) String() string {
+	if ie == nil {
+		return "<nil IndexExpression>"
+	}
+	result := ""
+	if ie.Left != nil {
+		result += ie.Left.String()
+	}
+	result += "["
+	if ie.Index != nil {
+		result += ie.Index.String()
+	}
+	result += "]"
+	return result
+}
+
 // Prefix Expression (for operators like !)
 type PrefixExpression struct {
 	Token    token.Token // the prefix token
@@ -128,10 +231,42 @@ func (pe *PrefixExpression) String() string {
 	return result
 }
 
-// Variable Interpolation Expression (for {variable} in strings)
+// Visits Expression (for VISITS(name))
+type VisitsExpression struct {
+	Token token.Token // the VISITS token
+	Name  *Identifier
+}
+
+func (ve *VisitsExpression) expressionNode() {}
+func (ve *VisitsExpression) String() string {
+	if ve == nil {
+		return "<nil VisitsExpression>"
+	}
+	result := ve.Token.Lexeme + "("
+	if ve.Name != nil {
+		result += ve.Name.String()
+	}
+	result += ")"
+	return result
+}
+
+// Turns Expression (for TURNS)
+type TurnsExpression struct {
+	Token token.Token // the TURNS token
+}
+
+func (te *TurnsExpression) expressionNode() {}
+func (te *TurnsExpression) String() string {
+	if te == nil {
+		return "<nil TurnsExpression>"
+	}
+	return te.Token.Lexeme
+}
+
+// Interpolated String Expression (for "text {expression} <tool>" strings)
 type InterpolatedString struct {
 	Token token.Token
-	Parts []Expression // mix of StringLiteral and Identifier
+	Parts []Expression // StringLiteral for text, any other expression was written in braces
 }
 
 func (is *InterpolatedString) expressionNode() {}
@@ -141,19 +276,68 @@ func (is *InterpolatedString) String() string {
 	}
 	result := "\""
 	for _, part := range is.Parts {
-		if part == nil {
+		switch p := part.(type) {
+		case nil:
 			continue
-		}
-		if ident, ok := part.(*Identifier); ok {
-			result += "{" + ident.String() + "}"
-		} else {
-			result += part.String()
+		case *StringLiteral:
+			result += EscapeText(p.Value)
+		case *ToolCall:
+			result += p.String()
+		default:
+			result += "{" + p.String() + "}"
 		}
 	}
 	result += "\""
 	return result
 }
 
+// Conditional Text Expression (for {IF tired: "exhausted" ELSE "fine"} in strings)
+type ConditionalText struct {
+	Token       token.Token // the IF token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression // can be nil, the text is empty then
+}
+
+func (ct *ConditionalText) expressionNode() {}
+func (ct *ConditionalText) String() string {
+	if ct == nil {
+		return "<nil ConditionalText>"
+	}
+	result := "IF "
+	if ct.Condition != nil {
+		result += ct.Condition.String()
+	}
+	result += ": "
+	if ct.Consequence != nil {
+		result += ct.Consequence.String()
+	}
+	if ct.Alternative != nil {
+		result += " ELSE " + ct.Alternative.String()
+	}
+	return result
+}
+
+// Alternative Text Expression (for {~"Hi"|"Hello"|"Hey"} in strings)
+type AlternativeText struct {
+	Token   token.Token // the '~' token
+	Options []Expression
+}
+
+func (at *AlternativeText) expressionNode() {}
+func (at *AlternativeText) String() string {
+	if at == nil {
+		return "<nil AlternativeText>"
+	}
+	options := make([]string, 0, len(at.Options))
+	for _, option := range at.Options {
+		if option != nil {
+			options = append(options, option.String())
+		}
+	}
+	return "~" + strings.Join(options, "|")
+}
+
 // Tool Call Expression (for <function; arg1, arg2>)
 type ToolCall struct {
 	Token     token.Token  // the '<' token
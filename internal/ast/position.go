@@ -0,0 +1,86 @@
+package ast
+
+import "quill/internal/token"
+
+// ExpressionToken returns the token an expression starts at, the left
+// operand for infix and index expressions
+func ExpressionToken(expr Expression) token.Token {
+	switch node := expr.(type) {
+	case *Identifier:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *InterpolatedString:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *FloatLiteral:
+		return node.Token
+	case *BooleanLiteral:
+		return node.Token
+	case *ListLiteral:
+		return node.Token
+	case *MapLiteral:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *InfixExpression:
+		return ExpressionToken(node.Left)
+	case *IndexExpression:
+		return ExpressionToken(node.Left)
+	case *ToolCall:
+		return node.Token
+	case *VisitsExpression:
+		return node.Token
+	case *TurnsExpression:
+		return node.Token
+	case *ConditionalText:
+		return node.Token
+	case *AlternativeText:
+		return node.Token
+	default:
+		return token.Token{}
+	}
+}
+
+// StatementToken returns the first token of a statement
+func StatementToken(stmt Statement) token.Token {
+	switch node := stmt.(type) {
+	case *LetStatement:
+		return node.Token
+	case *AssignStatement:
+		return node.Name.Token
+	case *DialogStatement:
+		return node.Character.Token
+	case *IfStatement:
+		return node.Token
+	case *MatchStatement:
+		return node.Token
+	case *ForStatement:
+		return node.Token
+	case *ChoiceStatement:
+		return node.Token
+	case *RandomStatement:
+		return node.Token
+	case *SequenceStatement:
+		return node.Token
+	case *LabelStatement:
+		return node.Token
+	case *GotoStatement:
+		return node.Token
+	case *CallStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *EndStatement:
+		return node.Token
+	case *SceneStatement:
+		return node.Token
+	case *IncludeStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	default:
+		return token.Token{}
+	}
+}
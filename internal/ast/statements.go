@@ -1,6 +1,9 @@
 package ast
 
-import "quill/internal/token"
+import (
+	"quill/internal/token"
+	"strings"
+)
 
 type LabelStatement struct {
 	Token token.Token
@@ -36,6 +39,100 @@ func (gs *GotoStatement) String() string {
 	return result
 }
 
+type SceneStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Body  *BlockStatement
+}
+
+func (ss *SceneStatement) statementNode() {}
+func (ss *SceneStatement) String() string {
+	if ss == nil {
+		return "<nil SceneStatement>"
+	}
+	result := ss.Token.Lexeme
+	if ss.Name != nil {
+		result += " " + ss.Name.String()
+	}
+	if ss.Body != nil {
+		result += " " + ss.Body.String()
+	}
+	return result
+}
+
+type CallStatement struct {
+	Token token.Token
+	Scene *Identifier
+}
+
+func (cs *CallStatement) statementNode() {}
+func (cs *CallStatement) String() string {
+	if cs == nil {
+		return "<nil CallStatement>"
+	}
+	result := cs.Token.Lexeme
+	if cs.Scene != nil {
+		result += " " + cs.Scene.String()
+	}
+	return result
+}
+
+type ReturnStatement struct {
+	Token token.Token
+}
+
+func (rs *ReturnStatement) statementNode() {}
+func (rs *ReturnStatement) String() string {
+	if rs == nil {
+		return "<nil ReturnStatement>"
+	}
+	return rs.Token.Lexeme
+}
+
+type IncludeStatement struct {
+	Token token.Token
+	Path  *StringLiteral  // the path as written in the script
+	File  string          // the resolved path of the included file
+	Body  *BlockStatement // the top level statements of the included file
+}
+
+func (is *IncludeStatement) statementNode() {}
+func (is *IncludeStatement) String() string {
+	if is == nil {
+		return "<nil IncludeStatement>"
+	}
+	result := is.Token.Lexeme
+	if is.Path != nil {
+		result += " " + is.Path.String()
+	}
+	if is.Body != nil {
+		result += " " + is.Body.String()
+	}
+	return result
+}
+
+// Namespace returns the namespace of labels and scenes declared in a file,
+// which is the file name without directory and extension
+func Namespace(file string) string {
+	if file == "" {
+		return ""
+	}
+	base := file[strings.LastIndexAny(file, `/\`)+1:]
+	if dot := strings.LastIndex(base, "."); dot > 0 {
+		base = base[:dot]
+	}
+	return base
+}
+
+// QualifiedName prefixes a label or scene name with its file's namespace
+func QualifiedName(file string, name string) string {
+	namespace := Namespace(file)
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
+
 type EndStatement struct {
 	Token token.Token
 }
@@ -77,12 +174,16 @@ func (ds *DialogStatement) String() string {
 type ChoiceStatement struct {
 	Token   token.Token
 	Options []*ChoiceOption
+	End     token.Token // the closing '}'
 }
 
 type ChoiceOption struct {
-	Text Expression
-	Body *BlockStatement
-	Tags *TagList
+	Once      bool // the option disappears after it has been chosen
+	Text      Expression
+	Name      *Identifier // can be nil, used to read how often the option was chosen
+	Condition Expression  // can be nil, the option is only shown when it is true
+	Body      *BlockStatement
+	Tags      *TagList
 }
 
 func (co *ChoiceOption) String() string {
@@ -90,9 +191,18 @@ func (co *ChoiceOption) String() string {
 		return "<nil ChoiceOption>"
 	}
 	result := ""
+	if co.Once {
+		result += "ONCE "
+	}
 	if co.Text != nil {
 		result += co.Text.String()
 	}
+	if co.Name != nil {
+		result += " AS " + co.Name.String()
+	}
+	if co.Condition != nil {
+		result += " IF " + co.Condition.String()
+	}
 	if co.Body != nil {
 		result += " " + co.Body.String()
 	}
@@ -120,6 +230,7 @@ func (cs *ChoiceStatement) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	End        token.Token // the closing '}'
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -140,11 +251,14 @@ func (bs *BlockStatement) String() string {
 type RandomStatement struct {
 	Token   token.Token
 	Options []*RandomOption
+	End     token.Token // the closing '}'
 }
 
 type RandomOption struct {
-	Body *BlockStatement
-	Tags *TagList
+	Weight    *IntegerLiteral // can be nil, options have a weight of 1 by default
+	Condition Expression      // can be nil, the option can only be picked when it is true
+	Body      *BlockStatement
+	Tags      *TagList
 }
 
 func (ro *RandomOption) String() string {
@@ -152,6 +266,12 @@ func (ro *RandomOption) String() string {
 		return "<nil RandomOption>"
 	}
 	result := ""
+	if ro.Weight != nil {
+		result += ro.Weight.String() + " "
+	}
+	if ro.Condition != nil {
+		result += "IF " + ro.Condition.String() + " "
+	}
 	if ro.Body != nil {
 		result += ro.Body.String()
 	}
@@ -176,6 +296,106 @@ func (rs *RandomStatement) String() string {
 	return result
 }
 
+// Match Statement, runs the first case whose value equals the matched value
+type MatchStatement struct {
+	Token token.Token // the MATCH token
+	Value Expression
+	Cases []*MatchCase
+	End   token.Token // the closing '}'
+}
+
+// MatchCase is a case of a MATCH statement. The wildcard case _ has no value
+// and matches everything.
+type MatchCase struct {
+	Token token.Token // the first token of the case
+	Value Expression  // nil for the wildcard case
+	Body  *BlockStatement
+}
+
+func (mc *MatchCase) String() string {
+	if mc == nil {
+		return "<nil MatchCase>"
+	}
+	result := "_"
+	if mc.Value != nil {
+		result = mc.Value.String()
+	}
+	if mc.Body != nil {
+		result += " " + mc.Body.String()
+	}
+	return result
+}
+
+func (ms *MatchStatement) statementNode() {}
+func (ms *MatchStatement) String() string {
+	if ms == nil {
+		return "<nil MatchStatement>"
+	}
+	result := ms.Token.Lexeme + " "
+	if ms.Value != nil {
+		result += ms.Value.String()
+	}
+	result += " {\n"
+	for _, matchCase := range ms.Cases {
+		if matchCase != nil {
+			result += "  " + matchCase.String() + "\n"
+		}
+	}
+	result += "}"
+	return result
+}
+
+// For Statement, runs its body once for every item of a list or every key of a map
+type ForStatement struct {
+	Token    token.Token // the FOR token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) String() string {
+	if fs == nil {
+		return "<nil ForStatement>"
+	}
+	result := fs.Token.Lexeme + " "
+	if fs.Variable != nil {
+		result += fs.Variable.String()
+	}
+	result += " IN "
+	if fs.Iterable != nil {
+		result += fs.Iterable.String()
+	}
+	result += " "
+	if fs.Body != nil {
+		result += fs.Body.String()
+	}
+	return result
+}
+
+// Sequence Statement, runs one option each time it is reached. The token type
+// (CYCLE, STOPPING, SHUFFLE or ONCE) decides which option that is.
+type SequenceStatement struct {
+	Token   token.Token
+	Options []*BlockStatement
+	End     token.Token // the closing '}'
+}
+
+func (ss *SequenceStatement) statementNode() {}
+func (ss *SequenceStatement) String() string {
+	if ss == nil {
+		return "<nil SequenceStatement>"
+	}
+	result := ss.Token.Lexeme + " {\n"
+	for _, option := range ss.Options {
+		if option != nil {
+			result += "  " + option.String() + "\n"
+		}
+	}
+	result += "}"
+	return result
+}
+
 // Variable Declaration Statement
 type LetStatement struct {
 	Token token.Token // the LET token
@@ -227,9 +447,33 @@ type IfStatement struct {
 	Token       token.Token // the IF token
 	Condition   Expression
 	Consequence *BlockStatement
+	ElseIfs     []*ElseIfClause
 	Alternative *BlockStatement // can be nil
 }
 
+// ElseIfClause is an ELSE IF branch, checked in order when the conditions
+// before it are false
+type ElseIfClause struct {
+	Token       token.Token // the IF token after ELSE
+	Condition   Expression
+	Consequence *BlockStatement
+}
+
+func (ec *ElseIfClause) String() string {
+	if ec == nil {
+		return "<nil ElseIfClause>"
+	}
+	result := "ELSE IF "
+	if ec.Condition != nil {
+		result += ec.Condition.String()
+	}
+	result += " "
+	if ec.Consequence != nil {
+		result += ec.Consequence.String()
+	}
+	return result
+}
+
 func (is *IfStatement) statementNode() {}
 func (is *IfStatement) String() string {
 	if is == nil {
@@ -243,6 +487,9 @@ func (is *IfStatement) String() string {
 	if is.Consequence != nil {
 		result += is.Consequence.String()
 	}
+	for _, elseIf := range is.ElseIfs {
+		result += " " + elseIf.String()
+	}
 	if is.Alternative != nil {
 		result += " ELSE " + is.Alternative.String()
 	}
@@ -0,0 +1,120 @@
+package ast
+
+// ChildBlocks returns the blocks nested directly inside a statement, in a
+// stable order. The position of a block in this list is used to address it.
+func ChildBlocks(stmt Statement) []*BlockStatement {
+	var blocks []*BlockStatement
+
+	switch node := stmt.(type) {
+	case *IfStatement:
+		blocks = append(blocks, node.Consequence)
+		for _, elseIf := range node.ElseIfs {
+			blocks = append(blocks, elseIf.Consequence)
+		}
+		if node.Alternative != nil {
+			blocks = append(blocks, node.Alternative)
+		}
+	case *MatchStatement:
+		for _, matchCase := range node.Cases {
+			blocks = append(blocks, matchCase.Body)
+		}
+	case *ChoiceStatement:
+		for _, option := range node.Options {
+			blocks = append(blocks, option.Body)
+		}
+	case *RandomStatement:
+		for _, option := range node.Options {
+			blocks = append(blocks, option.Body)
+		}
+	case *ForStatement:
+		blocks = append(blocks, node.Body)
+	case *SequenceStatement:
+		blocks = append(blocks, node.Options...)
+	case *SceneStatement:
+		blocks = append(blocks, node.Body)
+	case *IncludeStatement:
+		blocks = append(blocks, node.Body)
+	case *BlockStatement:
+		blocks = append(blocks, node)
+	}
+
+	return blocks
+}
+
+// Expressions returns the expressions a statement uses itself, without those
+// of the statements in its blocks
+func Expressions(stmt Statement) []Expression {
+	var expressions []Expression
+
+	switch node := stmt.(type) {
+	case *LetStatement:
+		expressions = append(expressions, node.Value)
+	case *AssignStatement:
+		expressions = append(expressions, node.Value)
+	case *DialogStatement:
+		expressions = append(expressions, node.Text)
+	case *IfStatement:
+		expressions = append(expressions, node.Condition)
+		for _, elseIf := range node.ElseIfs {
+			expressions = append(expressions, elseIf.Condition)
+		}
+	case *MatchStatement:
+		expressions = append(expressions, node.Value)
+		for _, matchCase := range node.Cases {
+			expressions = append(expressions, matchCase.Value)
+		}
+	case *ForStatement:
+		expressions = append(expressions, node.Iterable)
+	case *ChoiceStatement:
+		for _, option := range node.Options {
+			expressions = append(expressions, option.Text, option.Condition)
+		}
+	case *RandomStatement:
+		for _, option := range node.Options {
+			expressions = append(expressions, option.Condition)
+		}
+	}
+
+	return withoutNil(expressions)
+}
+
+// Operands returns the expressions nested directly inside an expression
+func Operands(expr Expression) []Expression {
+	var operands []Expression
+
+	switch node := expr.(type) {
+	case *InfixExpression:
+		operands = append(operands, node.Left, node.Right)
+	case *PrefixExpression:
+		operands = append(operands, node.Right)
+	case *IndexExpression:
+		operands = append(operands, node.Left, node.Index)
+	case *ListLiteral:
+		operands = append(operands, node.Elements...)
+	case *MapLiteral:
+		for idx := range node.Keys {
+			operands = append(operands, node.Keys[idx], node.Values[idx])
+		}
+	case *ToolCall:
+		operands = append(operands, node.Arguments...)
+	case *InterpolatedString:
+		operands = append(operands, node.Parts...)
+	case *ConditionalText:
+		operands = append(operands, node.Condition, node.Consequence, node.Alternative)
+	case *AlternativeText:
+		operands = append(operands, node.Options...)
+	}
+
+	return withoutNil(operands)
+}
+
+// withoutNil drops missing optional expressions, such as conditions
+func withoutNil(expressions []Expression) []Expression {
+	kept := expressions[:0]
+	for _, expr := range expressions {
+		if expr != nil {
+			kept = append(kept, expr)
+		}
+	}
+	return kept
+}
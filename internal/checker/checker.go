@@ -0,0 +1,406 @@
+package checker
+
+import (
+	"quill/internal/ast"
+	"quill/internal/token"
+	"sort"
+	"strconv"
+)
+
+// Severity tells how serious a diagnostic is. Errors fail at runtime, warnings
+// point at code that is most likely a mistake and infos at code that may be
+// left over.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+type Diagnostic struct {
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Offset   int      `json:"offset"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// HasErrors reports whether any of the diagnostics is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+type checker struct {
+	labels    map[string]*ast.LabelStatement
+	scenes    map[string]*ast.SceneStatement
+	options   map[string]*ast.ChoiceOption
+	variables map[string]int // variable name to the position of its first LET or FOR
+
+	targeted map[*ast.LabelStatement]bool // labels a GOTO jumps to or VISITS reads
+	looped   map[*ast.LabelStatement]bool // labels inside the body of a FOR loop
+	loops    int                          // FOR loops around the statements being declared
+	position int                          // statements visited so far, in the order they are written
+	files    map[string]int               // included file to the order it is included in, the main file is 0
+
+	diagnostics []Diagnostic
+}
+
+// Check analyzes a parsed program before it runs. It reports GOTO, CALL and
+// VISITS names that do not exist, labels and scenes defined twice, choice
+// options named like a label, variables used or assigned without a LET,
+// GOTOs into a FOR loop, unreachable statements, labels no GOTO targets and
+// conditions that can never be a boolean.
+func Check(program *ast.Program) []Diagnostic {
+	c := &checker{
+		labels:      make(map[string]*ast.LabelStatement),
+		scenes:      make(map[string]*ast.SceneStatement),
+		options:     make(map[string]*ast.ChoiceOption),
+		variables:   make(map[string]int),
+		targeted:    make(map[*ast.LabelStatement]bool),
+		looped:      make(map[*ast.LabelStatement]bool),
+		files:       make(map[string]int),
+		diagnostics: []Diagnostic{},
+	}
+
+	c.declareBlock(program.Statements)
+	c.checkOptionNames()
+	c.position = 0
+	c.checkBlock(program.Statements)
+	c.checkUnusedLabels()
+
+	// Keep files in the order they are included, and diagnostics in source order
+	sort.SliceStable(c.diagnostics, func(a, b int) bool {
+		left, right := c.diagnostics[a], c.diagnostics[b]
+		if left.File != right.File {
+			return c.files[left.File] < c.files[right.File]
+		}
+		return left.Offset < right.Offset
+	})
+
+	return c.diagnostics
+}
+
+func (c *checker) report(at token.Token, severity Severity, message string) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		File:     at.File,
+		Line:     at.Line,
+		Column:   at.Column,
+		Offset:   at.Offset,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+// declareBlock collects labels, scenes, named options and variables, in the
+// same order checkBlock visits the statements
+func (c *checker) declareBlock(statements []ast.Statement) {
+	for _, stmt := range statements {
+		c.position++
+
+		switch node := stmt.(type) {
+		case *ast.LabelStatement:
+			name := ast.QualifiedName(node.Token.File, node.Name.Value)
+			if first, exists := c.labels[name]; exists {
+				c.report(node.Name.Token, SeverityError, "Label '"+node.Name.Value+"' is already defined "+where(first.Name.Token, node.Name.Token))
+			} else {
+				c.labels[name] = node
+			}
+			c.looped[node] = c.loops > 0
+		case *ast.SceneStatement:
+			name := ast.QualifiedName(node.Token.File, node.Name.Value)
+			if first, exists := c.scenes[name]; exists {
+				c.report(node.Name.Token, SeverityError, "Scene '"+node.Name.Value+"' is already defined "+where(first.Name.Token, node.Name.Token))
+			} else {
+				c.scenes[name] = node
+			}
+		case *ast.ChoiceStatement:
+			for _, option := range node.Options {
+				if option.Name != nil {
+					c.options[ast.QualifiedName(option.Name.Token.File, option.Name.Value)] = option
+				}
+			}
+		case *ast.LetStatement:
+			c.declareVariable(node.Name.Value)
+		case *ast.ForStatement:
+			c.declareVariable(node.Variable.Value)
+		case *ast.IncludeStatement:
+			c.files[node.File] = len(c.files) + 1
+		}
+
+		_, isLoop := stmt.(*ast.ForStatement)
+		if isLoop {
+			c.loops++
+		}
+		for _, block := range ast.ChildBlocks(stmt) {
+			c.declareBlock(block.Statements)
+		}
+		if isLoop {
+			c.loops--
+		}
+	}
+}
+
+func (c *checker) declareVariable(name string) {
+	if _, exists := c.variables[name]; !exists {
+		c.variables[name] = c.position
+	}
+}
+
+// where describes the position of an earlier definition
+func where(first token.Token, duplicate token.Token) string {
+	if first.File != duplicate.File {
+		return "in " + first.File + " at line " + strconv.Itoa(first.Line)
+	}
+	return "at line " + strconv.Itoa(first.Line)
+}
+
+// checkBlock checks the statements of a block. Statements after END, GOTO or
+// RETURN never run, unless a LABEL makes them reachable again.
+func (c *checker) checkBlock(statements []ast.Statement) {
+	var terminator token.Token
+	reachable := true
+
+	for _, stmt := range statements {
+		switch stmt.(type) {
+		case *ast.LabelStatement:
+			reachable = true
+		case *ast.SceneStatement, *ast.IncludeStatement:
+			// Scenes are called from elsewhere and included files may hold labels
+		default:
+			if !reachable {
+				c.report(ast.StatementToken(stmt), SeverityWarning, "Unreachable statement after "+terminator.Lexeme)
+				// One warning for the whole unreachable part
+				reachable = true
+			}
+		}
+
+		c.checkStatement(stmt)
+
+		switch node := stmt.(type) {
+		case *ast.EndStatement:
+			reachable, terminator = false, node.Token
+		case *ast.GotoStatement:
+			reachable, terminator = false, node.Token
+		case *ast.ReturnStatement:
+			reachable, terminator = false, node.Token
+		}
+	}
+}
+
+func (c *checker) checkStatement(stmt ast.Statement) {
+	c.position++
+
+	switch node := stmt.(type) {
+	case *ast.LetStatement:
+		c.checkExpression(node.Value)
+	case *ast.AssignStatement:
+		c.checkAssignment(node)
+	case *ast.DialogStatement:
+		c.checkExpression(node.Text)
+	case *ast.IfStatement:
+		c.checkCondition(node.Condition, "IF condition")
+		for _, elseIf := range node.ElseIfs {
+			c.checkCondition(elseIf.Condition, "ELSE IF condition")
+		}
+	case *ast.MatchStatement:
+		c.checkExpression(node.Value)
+		for _, matchCase := range node.Cases {
+			if matchCase.Value != nil {
+				c.checkExpression(matchCase.Value)
+			}
+		}
+	case *ast.ForStatement:
+		c.checkExpression(node.Iterable)
+		if kind := staticType(node.Iterable); kind != "" && kind != "list" && kind != "map" {
+			c.report(ast.ExpressionToken(node.Iterable), SeverityError, "FOR can only loop over a list or map, found "+kind)
+		}
+	case *ast.ChoiceStatement:
+		for _, option := range node.Options {
+			c.checkExpression(option.Text)
+			if option.Condition != nil {
+				c.checkCondition(option.Condition, "Choice option condition")
+			}
+		}
+	case *ast.RandomStatement:
+		for _, option := range node.Options {
+			if option.Condition != nil {
+				c.checkCondition(option.Condition, "Random option condition")
+			}
+		}
+	case *ast.GotoStatement:
+		label, exists := c.labels[resolveName(c.labels, node.Label)]
+		if !exists {
+			c.report(node.Label.Token, SeverityError, "Label '"+node.Label.Value+"' is not defined")
+		} else {
+			c.targeted[label] = true
+			if c.looped[label] {
+				c.report(node.Label.Token, SeverityError, "Label '"+node.Label.Value+"' is inside a FOR loop, GOTO cannot jump into it")
+			}
+		}
+	case *ast.CallStatement:
+		if _, exists := c.scenes[resolveName(c.scenes, node.Scene)]; !exists {
+			c.report(node.Scene.Token, SeverityError, "Scene '"+node.Scene.Value+"' is not defined")
+		}
+	}
+
+	for _, block := range ast.ChildBlocks(stmt) {
+		c.checkBlock(block.Statements)
+	}
+}
+
+func (c *checker) checkAssignment(assign *ast.AssignStatement) {
+	c.checkExpression(assign.Value)
+
+	name := assign.Name.Value
+	declared, exists := c.variables[name]
+	if !exists {
+		c.report(assign.Name.Token, SeverityError, "Cannot assign to '"+name+"', it is never defined with LET")
+	} else if declared > c.position {
+		c.report(assign.Name.Token, SeverityWarning, "Variable '"+name+"' is assigned before it is defined")
+	}
+}
+
+func (c *checker) checkCondition(condition ast.Expression, description string) {
+	c.checkExpression(condition)
+
+	if kind := staticType(condition); kind != "" && kind != "bool" {
+		c.report(ast.ExpressionToken(condition), SeverityError, description+" must be a boolean, found "+kind)
+	}
+}
+
+func (c *checker) checkExpression(expr ast.Expression) {
+	switch node := expr.(type) {
+	case *ast.Identifier:
+		declared, exists := c.variables[node.Value]
+		if !exists {
+			c.report(node.Token, SeverityError, "Variable '"+node.Value+"' is not defined")
+		} else if declared > c.position {
+			c.report(node.Token, SeverityWarning, "Variable '"+node.Value+"' is used before it is defined")
+		}
+	case *ast.InfixExpression:
+		// The left side of ?? may be undefined, that is what the default is for
+		if node.Token.Type != token.NULL_COALESCE {
+			c.checkExpression(node.Left)
+		}
+		c.checkExpression(node.Right)
+	case *ast.PrefixExpression:
+		c.checkExpression(node.Right)
+	case *ast.IndexExpression:
+		c.checkExpression(node.Left)
+		c.checkExpression(node.Index)
+	case *ast.ListLiteral:
+		for _, element := range node.Elements {
+			c.checkExpression(element)
+		}
+	case *ast.MapLiteral:
+		for idx := range node.Keys {
+			c.checkExpression(node.Keys[idx])
+			c.checkExpression(node.Values[idx])
+		}
+	case *ast.ToolCall:
+		for _, argument := range node.Arguments {
+			c.checkExpression(argument)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			c.checkExpression(part)
+		}
+	case *ast.ConditionalText:
+		c.checkCondition(node.Condition, "Inline IF condition")
+		c.checkExpression(node.Consequence)
+		if node.Alternative != nil {
+			c.checkExpression(node.Alternative)
+		}
+	case *ast.AlternativeText:
+		for _, option := range node.Options {
+			c.checkExpression(option)
+		}
+	case *ast.VisitsExpression:
+		_, isLabel := c.labels[resolveName(c.labels, node.Name)]
+		_, isOption := c.options[resolveName(c.options, node.Name)]
+		if !isLabel && !isOption {
+			c.report(node.Name.Token, SeverityError, "No label or choice option named '"+node.Name.Value+"'")
+		}
+
+		// Reading how often a label was visited counts as using it
+		if label, exists := c.labels[resolveName(c.labels, node.Name)]; exists {
+			c.targeted[label] = true
+		}
+	}
+}
+
+// checkOptionNames reports named choice options that share their name with a
+// label, VISITS could not tell which one it counts
+func (c *checker) checkOptionNames() {
+	for name, option := range c.options {
+		if label, exists := c.labels[name]; exists {
+			c.report(option.Name.Token, SeverityError, "Choice option '"+option.Name.Value+"' has the same name as the label "+where(label.Name.Token, option.Name.Token)+", VISITS cannot tell them apart")
+		}
+	}
+}
+
+// checkUnusedLabels reports labels that no GOTO jumps to and no VISITS reads
+func (c *checker) checkUnusedLabels() {
+	for _, label := range c.labels {
+		if !c.targeted[label] {
+			c.report(label.Name.Token, SeverityInfo, "Label '"+label.Name.Value+"' is never targeted by a GOTO")
+		}
+	}
+}
+
+// resolveName looks up a label, scene or option name in the namespace of the
+// file it is used in, falling back to names declared outside of any file
+func resolveName[T any](declared map[string]T, name *ast.Identifier) string {
+	qualified := ast.QualifiedName(name.Token.File, name.Value)
+	if _, exists := declared[qualified]; exists {
+		return qualified
+	}
+	return name.Value
+}
+
+// staticType returns the type an expression always has, or "" if it is only
+// known at runtime
+func staticType(expr ast.Expression) string {
+	switch node := expr.(type) {
+	case *ast.StringLiteral, *ast.InterpolatedString:
+		return "string"
+	case *ast.IntegerLiteral:
+		return "int"
+	case *ast.FloatLiteral:
+		return "float"
+	case *ast.BooleanLiteral:
+		return "bool"
+	case *ast.ListLiteral:
+		return "list"
+	case *ast.MapLiteral:
+		return "map"
+	case *ast.PrefixExpression:
+		if node.Token.Type == token.NOT {
+			return "bool"
+		}
+		return staticType(node.Right)
+	case *ast.InfixExpression:
+		switch node.Token.Type {
+		case token.EQ, token.NE, token.LT, token.GT, token.LE, token.GE, token.AND, token.OR, token.IN:
+			return "bool"
+		case token.PLUS, token.MINUS, token.STAR, token.SLASH, token.PERCENT:
+			left, right := staticType(node.Left), staticType(node.Right)
+			switch {
+			case left == "int" && right == "int":
+				return "int"
+			case (left == "int" || left == "float") && (right == "int" || right == "float"):
+				return "float"
+			case left == "string" && right == "string" && node.Token.Type == token.PLUS:
+				return "string"
+			}
+		}
+	}
+	return ""
+}
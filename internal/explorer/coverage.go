@@ -0,0 +1,121 @@
+package explorer
+
+import (
+	"quill/internal/ast"
+)
+
+// Position identifies a statement by where it starts, so coverage collected
+// from separate parses of a script adds up
+type Position struct {
+	File   string
+	Offset int
+}
+
+func PositionOf(stmt ast.Statement) Position {
+	at := ast.StatementToken(stmt)
+	return Position{File: at.File, Offset: at.Offset}
+}
+
+// Coverage counts how often each statement ran
+type Coverage map[Position]int
+
+// Add counts a run of a statement, it can be passed to interpreter.WithTrace
+func (c Coverage) Add(stmt ast.Statement) {
+	c[PositionOf(stmt)]++
+}
+
+// Reached reports whether a statement or any statement inside it ran. A
+// SCENE is reached when it is called, even if execution never passes it.
+func (c Coverage) Reached(stmt ast.Statement) bool {
+	if c[PositionOf(stmt)] > 0 {
+		return true
+	}
+	for _, block := range ast.ChildBlocks(stmt) {
+		for _, nested := range block.Statements {
+			if c.Reached(nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Span is a run of statements that never ran
+type Span struct {
+	File       string
+	Line       int
+	EndLine    int
+	Statements int // statements in the span, nested ones included
+}
+
+// Unreached returns the parts of a program that never ran. Statements that
+// follow each other form one span, and statements inside a span are not
+// reported again.
+func (c Coverage) Unreached(program *ast.Program) []Span {
+	spans := []Span{}
+	c.unreachedIn(program.Statements, &spans)
+	return spans
+}
+
+func (c Coverage) unreachedIn(statements []ast.Statement, spans *[]Span) {
+	var current *Span
+	for _, stmt := range statements {
+		if c.Reached(stmt) {
+			current = nil
+			for _, block := range ast.ChildBlocks(stmt) {
+				c.unreachedIn(block.Statements, spans)
+			}
+			continue
+		}
+
+		at := ast.StatementToken(stmt)
+		if current == nil || current.File != at.File {
+			*spans = append(*spans, Span{File: at.File, Line: at.Line})
+			current = &(*spans)[len(*spans)-1]
+		}
+		current.EndLine = max(at.Line, endLine(stmt))
+		current.Statements += 1 + len(nestedStatements(stmt))
+	}
+}
+
+// UnreachedLabels returns the labels that never ran
+func (c Coverage) UnreachedLabels(program *ast.Program) []*ast.LabelStatement {
+	var labels []*ast.LabelStatement
+	for _, stmt := range Statements(program) {
+		if label, ok := stmt.(*ast.LabelStatement); ok && c[PositionOf(label)] == 0 {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// Statements returns every statement of a program in source order, nested
+// ones and those of included files included
+func Statements(program *ast.Program) []ast.Statement {
+	var statements []ast.Statement
+	for _, stmt := range program.Statements {
+		statements = append(statements, stmt)
+		statements = append(statements, nestedStatements(stmt)...)
+	}
+	return statements
+}
+
+func nestedStatements(stmt ast.Statement) []ast.Statement {
+	var statements []ast.Statement
+	for _, block := range ast.ChildBlocks(stmt) {
+		for _, nested := range block.Statements {
+			statements = append(statements, nested)
+			statements = append(statements, nestedStatements(nested)...)
+		}
+	}
+	return statements
+}
+
+// endLine returns the line of the closing '}' of a statement's last block
+func endLine(stmt ast.Statement) int {
+	blocks := ast.ChildBlocks(stmt)
+	if len(blocks) == 0 {
+		return ast.StatementToken(stmt).Line
+	}
+	return blocks[len(blocks)-1].End.Line
+}
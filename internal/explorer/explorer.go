@@ -0,0 +1,556 @@
+package explorer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"quill/internal/ast"
+	"quill/internal/interpreter"
+	"quill/internal/playtest"
+	"quill/internal/token"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxStates is the number of states explored when Options leave it out
+const DefaultMaxStates = 20000
+
+// stepLimit is the number of statements a script may run without a pause
+// before it counts as a loop that never ends
+const stepLimit = 10000
+
+// CountLimit is the highest visit, choice and turn count that tells states
+// apart when a script does more with a count than compare it to a number.
+// Without it a loop back to a label would never reach a known state.
+const CountLimit = 16
+
+// Options configure an exploration
+type Options struct {
+	Start     *interpreter.Snapshot   // state to start from, nil for the start of the script
+	Tools     []playtest.ToolResponse // every response matching a tool call is tried as its result
+	Seed      uint64                  // seed for SHUFFLE blocks, RANDOM blocks try every option
+	MaxStates int                     // 0 for DefaultMaxStates
+}
+
+// Finding is a problem on some path through the script
+type Finding struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Path    []string // the choices, RANDOM options and tool results that lead there
+}
+
+// Report is what an exploration found. Findings are sorted by position.
+type Report struct {
+	States       int      // distinct states the script was in
+	Complete     bool     // false when MaxStates ended the exploration early or Merged is set
+	Merged       bool     // counts above CountLimit that the script may tell apart were treated as equal
+	Coverage     Coverage // how often each statement ran over all paths
+	Unreached    []Span
+	Labels       []Finding // labels no path reaches
+	Loops        []Finding // places after which the script can never end
+	OpenEnds     []Finding // paths that run out of statements without END
+	Errors       []Finding // runtime errors
+	MissingTools []Finding // tool calls without a matching response
+}
+
+type stateKey [sha256.Size]byte
+
+// state is a point where the script paused: a line of dialog, a choice or a
+// tool call
+type state struct {
+	next  []stateKey
+	exits bool        // the script ends, fails or is not explored further after this state
+	at    token.Token // the statement the script paused at
+	path  []string
+}
+
+// branch is a way to continue from a saved state: an answer to the choice or
+// tool call it waits for, and the options RANDOM blocks pick on the way
+type branch struct {
+	snapshot *interpreter.Snapshot
+	from     stateKey
+	input    func(*interpreter.Interpreter) *interpreter.InterpreterResult // nil to just step
+	picks    []int
+	path     []string
+}
+
+type explorer struct {
+	program *ast.Program
+	options Options
+	report  *Report
+	states  map[stateKey]*state
+	queue   []branch
+	found   map[string]bool
+	visits  countUse
+	turns   countUse
+}
+
+// countUse is how a script reads VISITS or TURNS
+type countUse struct {
+	limit int  // counts above limit are treated as equal, 0 when the script never reads them
+	exact bool // the script only compares the count to numbers below limit
+}
+
+// Explore follows every choice option, RANDOM option and tool call result of
+// a script, breadth first so the paths in findings are as short as possible
+func Explore(program *ast.Program, options Options) (*Report, error) {
+	if options.MaxStates == 0 {
+		options.MaxStates = DefaultMaxStates
+	}
+
+	e := &explorer{
+		program: program,
+		options: options,
+		report: &Report{
+			Complete:     true,
+			Coverage:     make(Coverage),
+			Labels:       []Finding{},
+			Loops:        []Finding{},
+			OpenEnds:     []Finding{},
+			Errors:       []Finding{},
+			MissingTools: []Finding{},
+		},
+		states: make(map[stateKey]*state),
+		found:  make(map[string]bool),
+	}
+	e.visits, e.turns = observedCounts(program)
+
+	interp := interpreter.New(program, interpreter.WithSeed(options.Seed))
+	if options.Start != nil {
+		if err := interp.Restore(options.Start); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot, err := interp.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	key, err := e.key(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	start := &state{}
+	e.states[key] = start
+
+	// A snapshot saved while waiting for input continues with every answer
+	if pending := interp.PendingResult(); pending != nil {
+		e.expand(start, snapshot, key, pending)
+	} else {
+		e.queue = append(e.queue, branch{snapshot: snapshot, from: key})
+	}
+
+	for len(e.queue) > 0 {
+		next := e.queue[0]
+		e.queue = e.queue[1:]
+
+		if !e.report.Complete {
+			// Whatever lies beyond is unknown, not a loop
+			e.states[next.from].exits = true
+			continue
+		}
+		if err := e.follow(next); err != nil {
+			return nil, err
+		}
+	}
+
+	e.findLoops()
+
+	if e.report.Merged {
+		e.report.Complete = false
+	}
+	e.report.States = len(e.states)
+	e.report.Unreached = e.report.Coverage.Unreached(program)
+	for _, label := range e.report.Coverage.UnreachedLabels(program) {
+		e.find(&e.report.Labels, label.Token, "Label '"+label.Name.Value+"' is never reached", nil)
+	}
+	for _, findings := range [][]Finding{e.report.Labels, e.report.Loops, e.report.OpenEnds, e.report.Errors, e.report.MissingTools} {
+		sortFindings(findings)
+	}
+	return e.report, nil
+}
+
+// follow runs a branch until the script waits for input, reaches a known
+// state or stops
+func (e *explorer) follow(b branch) error {
+	var picks []int
+	var fresh []int  // positions in picks that were made, not replayed
+	var counts []int // the number of options for each fresh pick
+	var last ast.Statement
+	steps := 0
+	path := b.path
+
+	interp := interpreter.New(e.program,
+		interpreter.WithTrace(func(stmt ast.Statement) {
+			e.report.Coverage.Add(stmt)
+			last = stmt
+			steps++
+		}),
+		interpreter.WithRandomPick(func(random *ast.RandomStatement, available []*ast.RandomOption) int {
+			option := 0
+			if len(picks) < len(b.picks) {
+				option = b.picks[len(picks)]
+			} else {
+				fresh = append(fresh, len(picks))
+				counts = append(counts, len(available))
+			}
+			picks = append(picks, option)
+
+			number := slices.Index(random.Options, available[option]) + 1
+			path = extend(path, fmt.Sprintf("RANDOM at line %d runs option %d", random.Token.Line, number))
+			return option
+		}),
+		interpreter.WithStepLimit(stepLimit),
+	)
+	if err := interp.Restore(b.snapshot); err != nil {
+		return err
+	}
+
+	from := b.from
+	var result *interpreter.InterpreterResult
+	if b.input != nil {
+		result = b.input(interp)
+	}
+
+	for stopped := false; !stopped; {
+		if result == nil {
+			steps = 0
+			result = interp.Step()
+		}
+
+		// Where the script is, for findings
+		at := e.states[from].at
+		if last != nil {
+			at = ast.StatementToken(last)
+		}
+
+		switch result.Type {
+		case interpreter.DialogResult, interpreter.ChoiceResult, interpreter.ToolCallResult:
+			snapshot, err := interp.Snapshot()
+			if err != nil {
+				return err
+			}
+			key, err := e.key(snapshot)
+			if err != nil {
+				return err
+			}
+
+			// Dialog before the RANDOM picks of another branch was explored already
+			if result.Type == interpreter.DialogResult && len(picks) < len(b.picks) {
+				from, result = key, nil
+				continue
+			}
+
+			e.states[from].next = append(e.states[from].next, key)
+			if _, seen := e.states[key]; seen {
+				stopped = true
+				break
+			}
+			if len(e.states) >= e.options.MaxStates {
+				e.report.Complete = false
+				e.states[from].exits = true
+				stopped = true
+				break
+			}
+
+			current := &state{at: at, path: path}
+			e.states[key] = current
+			from = key
+
+			if result.Type == interpreter.DialogResult {
+				result = nil
+				continue
+			}
+			e.expand(current, snapshot, key, result)
+			stopped = true
+
+		case interpreter.EndResult:
+			e.states[from].exits = true
+			if _, isEnd := last.(*ast.EndStatement); !isEnd {
+				e.find(&e.report.OpenEnds, at, "Path ends without END", path)
+			}
+			stopped = true
+
+		case interpreter.ErrorResult:
+			e.states[from].exits = true
+			data := result.Data.(interpreter.ErrorData)
+			if data.Line > 0 {
+				at.Line, at.Column = data.Line, data.Column
+			}
+			if steps >= stepLimit {
+				e.find(&e.report.Loops, at, "Loop never pauses for dialog or input", path)
+			} else {
+				e.find(&e.report.Errors, at, data.Message, path)
+			}
+			stopped = true
+		}
+	}
+
+	// Every other option of the RANDOM blocks picked for the first time
+	for idx, position := range fresh {
+		for option := 1; option < counts[idx]; option++ {
+			e.queue = append(e.queue, branch{
+				snapshot: b.snapshot,
+				from:     b.from,
+				input:    b.input,
+				picks:    append(slices.Clone(picks[:position]), option),
+				path:     b.path,
+			})
+		}
+	}
+	return nil
+}
+
+// expand adds a branch for every answer to the choice or tool call a state
+// waits for
+func (e *explorer) expand(current *state, snapshot *interpreter.Snapshot, key stateKey, result *interpreter.InterpreterResult) {
+	switch data := result.Data.(type) {
+	case interpreter.ChoiceData:
+		for _, option := range data.Options {
+			index := option.Index
+			e.queue = append(e.queue, branch{
+				snapshot: snapshot,
+				from:     key,
+				input: func(interp *interpreter.Interpreter) *interpreter.InterpreterResult {
+					return interp.HandleChoiceInput(index)
+				},
+				path: extend(current.path, "choose "+strconv.Quote(option.Text)),
+			})
+		}
+
+	case interpreter.ToolCallData:
+		call := describeCall(data)
+		answered := false
+		for _, tool := range e.options.Tools {
+			if !tool.Matches(data.Function, data.Arguments) {
+				continue
+			}
+			answered = true
+
+			value := tool.Result
+			e.queue = append(e.queue, branch{
+				snapshot: snapshot,
+				from:     key,
+				input: func(interp *interpreter.Interpreter) *interpreter.InterpreterResult {
+					return interp.HandleToolCallResponse(value)
+				},
+				path: extend(current.path, call+" returns "+encode(value)),
+			})
+		}
+
+		if !answered {
+			current.exits = true
+			e.find(&e.report.MissingTools, current.at, "No stub for tool call "+call, current.path)
+		}
+	}
+}
+
+// findLoops reports the states after which the script can never end. Only
+// the first state of such a part is reported, where a path enters it.
+func (e *explorer) findLoops() {
+	previous := make(map[stateKey][]stateKey)
+	canExit := make(map[stateKey]bool)
+	var work []stateKey
+	for key, current := range e.states {
+		for _, next := range current.next {
+			previous[next] = append(previous[next], key)
+		}
+		if current.exits {
+			canExit[key] = true
+			work = append(work, key)
+		}
+	}
+
+	for len(work) > 0 {
+		key := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, before := range previous[key] {
+			if !canExit[before] {
+				canExit[before] = true
+				work = append(work, before)
+			}
+		}
+	}
+
+	for key, current := range e.states {
+		if canExit[key] {
+			continue
+		}
+
+		entered := len(previous[key]) == 0
+		for _, before := range previous[key] {
+			entered = entered || canExit[before]
+		}
+		if entered {
+			e.find(&e.report.Loops, current.at, "Loop with no way out, the script never ends after this", current.path)
+		}
+	}
+}
+
+// find adds a finding unless the same one was found on another path
+func (e *explorer) find(findings *[]Finding, at token.Token, message string, path []string) {
+	id := fmt.Sprintf("%s:%d:%d:%s", at.File, at.Line, at.Column, message)
+	if e.found[id] {
+		return
+	}
+	e.found[id] = true
+
+	*findings = append(*findings, Finding{
+		File:    at.File,
+		Line:    at.Line,
+		Column:  at.Column,
+		Message: message,
+		Path:    path,
+	})
+}
+
+// key identifies the state in a snapshot. Counts the script cannot tell apart
+// are merged, so loops come back to a state that was seen before.
+func (e *explorer) key(snapshot *interpreter.Snapshot) (stateKey, error) {
+	normalized := *snapshot
+
+	normalized.Turns = e.limitCount(snapshot.Turns, e.turns)
+
+	// The generator moves on with every inline alternative and SHUFFLE, so a
+	// loop through them would never come back to a known state
+	normalized.Random = nil
+
+	// Without VISITS only once-only options depend on having been chosen
+	chosen := countUse{limit: 1, exact: true}
+	if e.visits.limit > 0 {
+		chosen = e.visits
+	}
+	normalized.Visits = make(map[string]int)
+	for path, count := range snapshot.Visits {
+		if e.visits.limit > 0 {
+			normalized.Visits[path] = e.limitCount(count, e.visits)
+		}
+	}
+	normalized.Chosen = make(map[string]int)
+	for path, count := range snapshot.Chosen {
+		normalized.Chosen[path] = e.limitCount(count, chosen)
+	}
+
+	// Sequences behave the same once every option was shown, apart from where
+	// a CYCLE or SHUFFLE is in its round
+	normalized.Sequences = make(map[string]interpreter.SequenceSnapshot)
+	for path, sequence := range snapshot.Sequences {
+		if sequence.Count >= sequence.Size {
+			sequence.Count = sequence.Size + sequence.Count%sequence.Size
+		}
+		normalized.Sequences[path] = sequence
+	}
+
+	encoded, err := json.Marshal(&normalized)
+	if err != nil {
+		return stateKey{}, err
+	}
+	return sha256.Sum256(encoded), nil
+}
+
+// limitCount caps a count at the limit of its use and notes when the script
+// could still have told the merged counts apart
+func (e *explorer) limitCount(count int, use countUse) int {
+	if count <= use.limit {
+		return count
+	}
+	if use.limit > 0 && !use.exact {
+		e.report.Merged = true
+	}
+	return use.limit
+}
+
+// observedCounts reports how a script reads visit or choice counts with
+// VISITS, and the number of choices made with TURNS. A count only compared to
+// numbers is told apart up to the largest of them, any other use up to
+// CountLimit.
+func observedCounts(program *ast.Program) (visits countUse, turns countUse) {
+	visits.exact, turns.exact = true, true
+
+	use := func(expr ast.Expression) *countUse {
+		switch expr.(type) {
+		case *ast.VisitsExpression:
+			return &visits
+		case *ast.TurnsExpression:
+			return &turns
+		}
+		return nil
+	}
+
+	var inspect func(ast.Expression)
+	inspect = func(expr ast.Expression) {
+		if infix, ok := expr.(*ast.InfixExpression); ok && slices.Contains([]string{"==", "!=", "<", ">", "<=", ">="}, infix.Operator) {
+			count, number := use(infix.Left), infix.Right
+			if count == nil {
+				count, number = use(infix.Right), infix.Left
+			}
+			if literal, ok := number.(*ast.IntegerLiteral); ok && count != nil {
+				count.limit = max(count.limit, int(literal.Value)+1)
+				return
+			}
+		}
+
+		if count := use(expr); count != nil {
+			count.limit = max(count.limit, 1)
+			count.exact = false
+		}
+		for _, operand := range ast.Operands(expr) {
+			inspect(operand)
+		}
+	}
+
+	for _, stmt := range Statements(program) {
+		for _, expr := range ast.Expressions(stmt) {
+			inspect(expr)
+		}
+	}
+
+	for _, count := range []*countUse{&visits, &turns} {
+		if !count.exact {
+			count.limit = max(count.limit, CountLimit)
+		}
+	}
+	return visits, turns
+}
+
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(a, b int) bool {
+		if findings[a].File != findings[b].File {
+			return findings[a].File < findings[b].File
+		}
+		if findings[a].Line != findings[b].Line {
+			return findings[a].Line < findings[b].Line
+		}
+		return findings[a].Column < findings[b].Column
+	})
+}
+
+// extend returns a copy of path with one more step, so branches never share
+// the steps they add
+func extend(path []string, step string) []string {
+	return append(slices.Clip(path), step)
+}
+
+// describeCall writes a tool call the way it is written in a script
+func describeCall(call interpreter.ToolCallData) string {
+	if len(call.Arguments) == 0 {
+		return "<" + call.Function + ">"
+	}
+	arguments := make([]string, len(call.Arguments))
+	for idx, argument := range call.Arguments {
+		arguments[idx] = encode(argument)
+	}
+	return "<" + call.Function + "; " + strings.Join(arguments, ", ") + ">"
+}
+
+func encode(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
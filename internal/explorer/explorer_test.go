@@ -0,0 +1,71 @@
+package explorer
+
+import (
+	"quill/internal/parsetest"
+	"testing"
+)
+
+func TestTurnsAboveCountLimitReachLabel(t *testing.T) {
+	program := parsetest.Parse(t, `
+LABEL loop
+IF TURNS > 20 {
+    GOTO secret
+}
+CHOICE {
+    "Wait" { GOTO loop }
+}
+
+LABEL secret
+Narrator: "You waited long enough."
+END
+`)
+
+	report, err := Explore(program, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finding := range report.Labels {
+		t.Errorf("unexpected finding at line %d: %s", finding.Line, finding.Message)
+	}
+	if !report.Complete {
+		t.Error("exploration is incomplete, though TURNS is only compared to a number")
+	}
+}
+
+func TestMergedCountsMakeReportIncomplete(t *testing.T) {
+	program := parsetest.Parse(t, `
+LABEL loop
+Narrator: "Turn {TURNS}"
+CHOICE {
+    "Wait" { GOTO loop },
+    "Leave" { END }
+}
+`)
+
+	report, err := Explore(program, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Merged || report.Complete {
+		t.Errorf("got Merged %v and Complete %v, want counts merged and an incomplete report", report.Merged, report.Complete)
+	}
+}
+
+func TestLoopWithAlternativesFinishes(t *testing.T) {
+	program := parsetest.Parse(t, `
+LABEL hub
+A: "{~"Hi"|"Hey"}"
+CHOICE {
+    "again" { GOTO hub },
+    "leave" { END }
+}
+`)
+
+	report, err := Explore(program, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Complete {
+		t.Errorf("exploration stopped after %d states", report.States)
+	}
+}
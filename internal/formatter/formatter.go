@@ -0,0 +1,433 @@
+package formatter
+
+import (
+	"quill/internal/ast"
+	"quill/internal/parser"
+	"quill/internal/scanner"
+	"quill/internal/token"
+	"sort"
+	"strings"
+)
+
+const indentation = "    "
+
+// Source formats a script. Nothing is formatted when it has scanner or parser
+// errors, they are returned instead.
+func Source(file string, source string) (string, []scanner.ScannerError, []parser.ParseError) {
+	tokens, scannerErrors := scanner.NewWithFile(source, file).ScanTokens()
+	if len(scannerErrors) > 0 {
+		return "", scannerErrors, nil
+	}
+
+	program, parserErrors := parser.NewWithLoader(tokens, skipIncludes).Parse()
+	if len(parserErrors) > 0 {
+		return "", nil, parserErrors
+	}
+
+	return Format(program, tokens), nil, nil
+}
+
+// skipIncludes stands in for included files, they are formatted on their own
+func skipIncludes(path string) (string, error) {
+	return "", nil
+}
+
+// Format prints a program in the canonical layout. The tokens it was parsed
+// from give back the comments and blank lines the parser skips. Blocks that
+// were written on one line with at most one simple statement stay on one line.
+func Format(program *ast.Program, tokens []token.Token) string {
+	p := &printer{tokens: tokens}
+	for _, tok := range tokens {
+		if tok.Type == token.COMMENT {
+			p.comments = append(p.comments, tok)
+		}
+	}
+
+	p.statements(program.Statements, -1)
+
+	if len(p.lines) == 0 {
+		return ""
+	}
+	return strings.Join(p.lines, "\n") + "\n"
+}
+
+// Expression prints an expression the way Format writes it
+func Expression(expr ast.Expression) string {
+	return (&printer{}).expression(expr)
+}
+
+type printer struct {
+	tokens   []token.Token
+	comments []token.Token
+	next     int // index of the next comment to print
+
+	lines    []string
+	indent   int
+	lastLine int // source line the last printed element ends on, 0 at the start of a block
+}
+
+// write starts a new line at the current indentation
+func (p *printer) write(text string) {
+	if text == "" {
+		p.lines = append(p.lines, "")
+		return
+	}
+	p.lines = append(p.lines, strings.Repeat(indentation, p.indent)+text)
+}
+
+// separate keeps a single blank line where the source has one or more
+// between two elements of a block
+func (p *printer) separate(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.write("")
+	}
+}
+
+// flushComments prints the comments before offset, or all remaining ones if
+// offset is negative. A comment behind code stays at the end of its line.
+func (p *printer) flushComments(offset int) {
+	for p.next < len(p.comments) {
+		comment := p.comments[p.next]
+		if offset >= 0 && comment.Offset >= offset {
+			return
+		}
+		p.next++
+
+		text := strings.TrimRight(comment.Lexeme, " \t\r")
+		if p.trailing(comment) && len(p.lines) > 0 {
+			p.lines[len(p.lines)-1] += " " + text
+			continue
+		}
+
+		p.separate(comment.Line)
+		p.write(text)
+		p.lastLine = comment.Line
+	}
+}
+
+// trailing reports whether code comes before a comment on its line
+func (p *printer) trailing(comment token.Token) bool {
+	index := p.tokenIndex(comment.Offset)
+	return index > 0 && p.tokens[index-1].Type != token.NEWLINE
+}
+
+// tokenIndex returns the index of the first token at or after offset
+func (p *printer) tokenIndex(offset int) int {
+	return sort.Search(len(p.tokens), func(i int) bool {
+		return p.tokens[i].Offset >= offset
+	})
+}
+
+// endLine returns the source line an element starting at offset ends on. It
+// ends at a line break, a comma or the '}' of the block around it.
+func (p *printer) endLine(offset int) int {
+	index := p.tokenIndex(offset)
+	if index >= len(p.tokens) {
+		return 0
+	}
+
+	depth := 0
+	last := p.tokens[index]
+	for _, tok := range p.tokens[index:] {
+		switch tok.Type {
+		case token.LBRACE, token.LBRACKET, token.LPAREN:
+			depth++
+		case token.RBRACE, token.RBRACKET, token.RPAREN:
+			if depth == 0 {
+				return lastLineOf(last)
+			}
+			depth--
+		case token.NEWLINE, token.COMMENT, token.COMMA:
+			if depth == 0 {
+				return lastLineOf(last)
+			}
+		case token.EOF:
+			return lastLineOf(last)
+		}
+		if tok.Type != token.NEWLINE && tok.Type != token.COMMENT {
+			last = tok
+		}
+	}
+	return lastLineOf(last)
+}
+
+func lastLineOf(tok token.Token) int {
+	return tok.Line + strings.Count(tok.Lexeme, "\n")
+}
+
+// statements prints the statements of a block, with the comments and blank
+// lines between them. end is the offset of the block's '}', -1 for the file.
+func (p *printer) statements(statements []ast.Statement, end int) {
+	p.lastLine = 0
+	for _, stmt := range statements {
+		start := ast.StatementToken(stmt)
+		p.flushComments(start.Offset)
+		p.separate(start.Line)
+		p.statement(stmt)
+		p.lastLine = p.endLine(start.Offset)
+	}
+	p.flushComments(end)
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch node := stmt.(type) {
+	case *ast.IfStatement:
+		// The branches of an IF stay on one line only if all of them do
+		expand := false
+		for _, block := range ast.ChildBlocks(node) {
+			expand = expand || !p.inline(block)
+		}
+
+		p.block("IF "+p.expression(node.Condition), node.Consequence, expand)
+		for _, elseIf := range node.ElseIfs {
+			p.block(p.reopen()+" ELSE IF "+p.expression(elseIf.Condition), elseIf.Consequence, expand)
+		}
+		if node.Alternative != nil {
+			p.block(p.reopen()+" ELSE", node.Alternative, expand)
+		}
+
+	case *ast.ForStatement:
+		p.block("FOR "+node.Variable.Value+" IN "+p.expression(node.Iterable), node.Body, false)
+
+	case *ast.SceneStatement:
+		p.block("SCENE "+node.Name.Value, node.Body, false)
+
+	case *ast.MatchStatement:
+		p.write("MATCH " + p.expression(node.Value) + " {")
+		p.options(node.End, len(node.Cases), false, func(index int) token.Token {
+			return node.Cases[index].Token
+		}, func(index int) {
+			matchCase := node.Cases[index]
+			value := "_"
+			if matchCase.Value != nil {
+				value = p.expression(matchCase.Value)
+			}
+			p.block(value, matchCase.Body, false)
+		})
+
+	case *ast.ChoiceStatement:
+		p.write("CHOICE {")
+		p.options(node.End, len(node.Options), true, func(index int) token.Token {
+			return ast.ExpressionToken(node.Options[index].Text)
+		}, func(index int) {
+			option := node.Options[index]
+			header := p.expression(option.Text)
+			if option.Once {
+				header = "ONCE " + header
+			}
+			if option.Name != nil {
+				header += " AS " + option.Name.Value
+			}
+			if option.Condition != nil {
+				header += " IF " + p.expression(option.Condition)
+			}
+			p.block(header, option.Body, false)
+			if option.Tags != nil {
+				p.lines[len(p.lines)-1] += " " + option.Tags.String()
+			}
+		})
+
+	case *ast.RandomStatement:
+		p.write("RANDOM {")
+		p.options(node.End, len(node.Options), true, func(index int) token.Token {
+			option := node.Options[index]
+			if option.Weight != nil {
+				return option.Weight.Token
+			}
+			return option.Body.Token
+		}, func(index int) {
+			option := node.Options[index]
+			var header []string
+			if option.Weight != nil {
+				header = append(header, option.Weight.Token.Lexeme)
+			}
+			if option.Condition != nil {
+				header = append(header, "IF "+p.expression(option.Condition))
+			}
+			p.block(strings.Join(header, " "), option.Body, false)
+			if option.Tags != nil {
+				p.lines[len(p.lines)-1] += " " + option.Tags.String()
+			}
+		})
+
+	case *ast.SequenceStatement:
+		p.write(node.Token.Lexeme + " {")
+		p.options(node.End, len(node.Options), true, func(index int) token.Token {
+			return node.Options[index].Token
+		}, func(index int) {
+			p.block("", node.Options[index], false)
+		})
+
+	default:
+		p.write(p.simpleStatement(stmt))
+	}
+}
+
+// options prints the options of a CHOICE, RANDOM, MATCH or sequence and the
+// closing '}'. Options are separated by commas when commas is set.
+func (p *printer) options(closing token.Token, count int, commas bool, start func(index int) token.Token, print func(index int)) {
+	p.indent++
+	p.lastLine = 0
+	for index := 0; index < count; index++ {
+		first := start(index)
+		p.flushComments(first.Offset)
+		p.separate(first.Line)
+		print(index)
+		if commas && index < count-1 {
+			p.lines[len(p.lines)-1] += ","
+		}
+		p.lastLine = p.endLine(first.Offset)
+	}
+	p.flushComments(closing.Offset)
+	p.indent--
+
+	p.write("}")
+}
+
+// block prints a header followed by a block on a new line, expand keeps the
+// block from staying on one line
+func (p *printer) block(header string, block *ast.BlockStatement, expand bool) {
+	if header != "" {
+		header += " "
+	}
+	if !expand && p.inline(block) {
+		if len(block.Statements) == 0 {
+			p.write(header + "{ }")
+		} else {
+			p.write(header + "{ " + p.simpleStatement(block.Statements[0]) + " }")
+		}
+		return
+	}
+
+	p.write(header + "{")
+	p.indent++
+	p.statements(block.Statements, block.End.Offset)
+	p.indent--
+	p.write("}")
+}
+
+// reopen removes the last line and returns it without indentation, so ELSE
+// can continue the line that closes the block before it
+func (p *printer) reopen() string {
+	last := p.lines[len(p.lines)-1]
+	p.lines = p.lines[:len(p.lines)-1]
+	return strings.TrimPrefix(last, strings.Repeat(indentation, p.indent))
+}
+
+// inline reports whether a block was written on one line and holds at most
+// one statement without blocks of its own
+func (p *printer) inline(block *ast.BlockStatement) bool {
+	if block.Token.Line != block.End.Line || len(block.Statements) > 1 {
+		return false
+	}
+	return len(block.Statements) == 0 || len(ast.ChildBlocks(block.Statements[0])) == 0
+}
+
+func (p *printer) simpleStatement(stmt ast.Statement) string {
+	switch node := stmt.(type) {
+	case *ast.DialogStatement:
+		result := node.Character.Value + ": " + p.expression(node.Text)
+		if node.Tags != nil {
+			result += " " + node.Tags.String()
+		}
+		return result
+	case *ast.LetStatement:
+		return "LET " + node.Name.Value + " = " + p.expression(node.Value)
+	case *ast.AssignStatement:
+		return node.Name.Value + " " + node.Operator.Lexeme + " " + p.expression(node.Value)
+	case *ast.LabelStatement:
+		return "LABEL " + node.Name.Value
+	case *ast.GotoStatement:
+		return "GOTO " + node.Label.Value
+	case *ast.CallStatement:
+		return "CALL " + node.Scene.Value
+	case *ast.IncludeStatement:
+		return "INCLUDE " + node.Path.String()
+	case *ast.ReturnStatement:
+		return "RETURN"
+	case *ast.EndStatement:
+		return "END"
+	default:
+		return stmt.String()
+	}
+}
+
+func (p *printer) expression(expr ast.Expression) string {
+	switch node := expr.(type) {
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(node.Token.Type)
+		return p.operand(node.Left, precedence, false) + " " + node.Operator + " " + p.operand(node.Right, precedence, true)
+	case *ast.PrefixExpression:
+		return node.Operator + p.operand(node.Right, parser.PREFIX, true)
+	case *ast.IndexExpression:
+		return p.operand(node.Left, parser.INDEX, false) + "[" + p.expression(node.Index) + "]"
+	case *ast.ListLiteral:
+		elements := make([]string, 0, len(node.Elements))
+		for _, element := range node.Elements {
+			elements = append(elements, p.expression(element))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *ast.MapLiteral:
+		pairs := make([]string, 0, len(node.Keys))
+		for idx, key := range node.Keys {
+			pairs = append(pairs, p.expression(key)+": "+p.expression(node.Values[idx]))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *ast.ToolCall:
+		if len(node.Arguments) == 0 {
+			return "<" + node.Function + ">"
+		}
+		arguments := make([]string, 0, len(node.Arguments))
+		for _, argument := range node.Arguments {
+			arguments = append(arguments, p.expression(argument))
+		}
+		return "<" + node.Function + "; " + strings.Join(arguments, ", ") + ">"
+	case *ast.InterpolatedString:
+		result := "\""
+		for _, part := range node.Parts {
+			switch text := part.(type) {
+			case *ast.StringLiteral:
+				result += ast.EscapeText(text.Value)
+			case *ast.ToolCall:
+				result += p.expression(text)
+			default:
+				result += "{" + p.expression(text) + "}"
+			}
+		}
+		return result + "\""
+	case *ast.ConditionalText:
+		result := "IF " + p.expression(node.Condition) + ": " + p.expression(node.Consequence)
+		if node.Alternative != nil {
+			result += " ELSE " + p.expression(node.Alternative)
+		}
+		return result
+	case *ast.AlternativeText:
+		options := make([]string, 0, len(node.Options))
+		for _, option := range node.Options {
+			options = append(options, p.expression(option))
+		}
+		return "~" + strings.Join(options, "|")
+	default:
+		return expr.String()
+	}
+}
+
+// operand prints an operand of an operator with precedence, in parentheses
+// when it binds less strongly. Operators are left associative, so an operand
+// on the right also needs them at the same precedence.
+func (p *printer) operand(expr ast.Expression, precedence int, right bool) string {
+	inner := parser.PREFIX
+	switch node := expr.(type) {
+	case *ast.InfixExpression:
+		inner = parser.Precedence(node.Token.Type)
+	case *ast.PrefixExpression:
+		inner = parser.PREFIX
+	default:
+		return p.expression(expr)
+	}
+
+	if inner < precedence || (right && inner == precedence) {
+		return "(" + p.expression(expr) + ")"
+	}
+	return p.expression(expr)
+}
@@ -0,0 +1,99 @@
+package formatter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func format(t *testing.T, file string, source string) string {
+	t.Helper()
+
+	formatted, scannerErrors, parserErrors := Source(file, source)
+	if len(scannerErrors) > 0 || len(parserErrors) > 0 {
+		t.Fatalf("%s: scanner errors %v, parser errors %v", file, scannerErrors, parserErrors)
+	}
+	return formatted
+}
+
+// The examples are kept in the canonical layout, so each is its own golden file
+func TestExamples(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no examples found")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			formatted := format(t, file, string(source))
+			if formatted != string(source) {
+				t.Errorf("example is not formatted, got:\n%s", formatted)
+			}
+			if again := format(t, file, formatted); again != formatted {
+				t.Errorf("formatting is not idempotent, got:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestCommentPlacement(t *testing.T) {
+	source := `# Header comment
+
+
+LET gold = 3    # trailing
+IF gold > 2 {
+  # inside before
+        Narrator: "Rich"   # after dialog
+   # before closing
+}
+CHOICE {
+# before first option
+    "A" { GOTO end },   # after option
+        # between options
+    "B" {
+        END
+    }
+}
+
+LABEL end # label comment
+END
+# Footer`
+
+	want := `# Header comment
+
+LET gold = 3 # trailing
+IF gold > 2 {
+    # inside before
+    Narrator: "Rich" # after dialog
+    # before closing
+}
+CHOICE {
+    # before first option
+    "A" { GOTO end }, # after option
+    # between options
+    "B" {
+        END
+    }
+}
+
+LABEL end # label comment
+END
+# Footer
+`
+
+	got := format(t, "comments.q", source)
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if again := format(t, "comments.q", got); again != got {
+		t.Errorf("formatting is not idempotent, got:\n%s", again)
+	}
+}
@@ -0,0 +1,327 @@
+package graph
+
+import (
+	"quill/internal/ast"
+	"quill/internal/formatter"
+	"quill/internal/interpreter"
+	"quill/internal/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type NodeKind int
+
+const (
+	StartNode NodeKind = iota
+	EndNode
+	LabelNode
+	ChoiceNode
+	RandomNode
+	SceneNode
+)
+
+type Node struct {
+	ID    string
+	Kind  NodeKind
+	Label string
+}
+
+type EdgeKind int
+
+const (
+	FlowEdge EdgeKind = iota // execution falls through to the next node
+	GotoEdge                 // a GOTO jumps to a label
+	CallEdge                 // a CALL runs a scene and continues afterwards
+	EndEdge                  // END stops the script
+)
+
+// Edge is a way from one node to the next. Edges leaving a choice or RANDOM
+// block are labeled with the text and tags of their option.
+type Edge struct {
+	From  string
+	To    string
+	Kind  EdgeKind
+	Label string
+}
+
+// Graph is the flow of a script between its labels, choices, RANDOM blocks
+// and scenes
+type Graph struct {
+	Name  string // the script file
+	Nodes []*Node
+	Edges []Edge
+}
+
+// pending is an edge that ends at the next node execution reaches
+type pending struct {
+	from  *Node
+	label string
+}
+
+type builder struct {
+	graph  *Graph
+	file   string
+	labels map[string]*ast.LabelStatement
+	scenes map[string]*ast.SceneStatement
+	nodes  map[ast.Statement]*Node
+	end    *Node
+	edges  map[Edge]bool
+}
+
+// Build returns the flow graph of a program. Dialog and variables are left
+// out, IF, MATCH, FOR and sequence blocks only add the ways around them.
+func Build(program *ast.Program, file string) *Graph {
+	b := &builder{
+		graph:  &Graph{Name: file},
+		file:   file,
+		labels: interpreter.Labels(program),
+		scenes: make(map[string]*ast.SceneStatement),
+		nodes:  make(map[ast.Statement]*Node),
+		edges:  make(map[Edge]bool),
+	}
+
+	// Captions with a space cannot be mistaken for a label of the same name
+	start := b.add(StartNode, "script start")
+	b.end = b.add(EndNode, "script end")
+
+	// Nodes are added up front, GOTO and CALL may refer to later ones
+	var scenes []*ast.SceneStatement
+	b.declare(program.Statements, &scenes)
+
+	// Running out of statements ends the script like END
+	rest := b.block(program.Statements, []pending{{from: start}})
+	b.connect(rest, b.end, FlowEdge)
+
+	// Scenes return to where they were called, so their last statements lead nowhere
+	for _, scene := range scenes {
+		b.block(scene.Body.Statements, []pending{{from: b.nodes[scene]}})
+	}
+
+	return b.graph
+}
+
+func (b *builder) declare(statements []ast.Statement, scenes *[]*ast.SceneStatement) {
+	for _, stmt := range statements {
+		switch node := stmt.(type) {
+		case *ast.LabelStatement:
+			b.nodes[node] = b.add(LabelNode, b.name(node.Token.File, node.Name.Value))
+		case *ast.ChoiceStatement:
+			b.nodes[node] = b.add(ChoiceNode, "CHOICE "+b.where(node.Token.File, node.Token.Line))
+		case *ast.RandomStatement:
+			b.nodes[node] = b.add(RandomNode, "RANDOM "+b.where(node.Token.File, node.Token.Line))
+		case *ast.SceneStatement:
+			b.nodes[node] = b.add(SceneNode, "SCENE "+b.name(node.Token.File, node.Name.Value))
+			b.scenes[ast.QualifiedName(node.Token.File, node.Name.Value)] = node
+			*scenes = append(*scenes, node)
+		}
+
+		for _, block := range ast.ChildBlocks(stmt) {
+			b.declare(block.Statements, scenes)
+		}
+	}
+}
+
+func (b *builder) add(kind NodeKind, label string) *Node {
+	node := &Node{
+		ID:    "n" + strconv.Itoa(len(b.graph.Nodes)),
+		Kind:  kind,
+		Label: label,
+	}
+	b.graph.Nodes = append(b.graph.Nodes, node)
+	return node
+}
+
+// name writes a label or scene name the way the script's own file refers to it
+func (b *builder) name(file string, name string) string {
+	if file == b.file {
+		return name
+	}
+	return ast.QualifiedName(file, name)
+}
+
+func (b *builder) where(file string, line int) string {
+	if file == b.file {
+		return "line " + strconv.Itoa(line)
+	}
+	return file + " line " + strconv.Itoa(line)
+}
+
+// block follows the statements of a block and returns the edges that leave it
+func (b *builder) block(statements []ast.Statement, from []pending) []pending {
+	for _, stmt := range statements {
+		from = unique(b.statement(stmt, from))
+	}
+	return from
+}
+
+func (b *builder) statement(stmt ast.Statement, from []pending) []pending {
+	switch node := stmt.(type) {
+	case *ast.LabelStatement:
+		return b.enter(from, b.nodes[node])
+
+	case *ast.ChoiceStatement:
+		choice := b.enter(from, b.nodes[node])
+		var next []pending
+		hidden := true
+		for _, option := range node.Options {
+			next = append(next, b.block(option.Body.Statements, []pending{{from: choice[0].from, label: optionLabel(option.Text, option.Tags)}})...)
+			hidden = hidden && (option.Once || option.Condition != nil)
+		}
+		// Without any option to show the script continues after the CHOICE
+		if hidden {
+			next = append(next, choice...)
+		}
+		return next
+
+	case *ast.RandomStatement:
+		random := b.enter(from, b.nodes[node])
+		var next []pending
+		hidden := true
+		for _, option := range node.Options {
+			label := tagLabel("", option.Tags)
+			if option.Weight != nil {
+				label = tagLabel("weight "+strconv.FormatInt(option.Weight.Value, 10), option.Tags)
+			}
+			next = append(next, b.block(option.Body.Statements, []pending{{from: random[0].from, label: label}})...)
+			hidden = hidden && option.Condition != nil
+		}
+		if hidden {
+			next = append(next, random...)
+		}
+		return next
+
+	case *ast.GotoStatement:
+		if label, exists := b.labels[resolveName(b.labels, node.Label)]; exists {
+			b.connect(from, b.nodes[label], GotoEdge)
+		}
+		return nil
+
+	case *ast.CallStatement:
+		if scene, exists := b.scenes[resolveName(b.scenes, node.Scene)]; exists {
+			b.connect(from, b.nodes[scene], CallEdge)
+		}
+		return from
+
+	case *ast.EndStatement:
+		b.connect(from, b.end, EndEdge)
+		return nil
+
+	case *ast.ReturnStatement:
+		return nil
+
+	case *ast.SceneStatement:
+		// Scenes only run when called
+		return from
+
+	case *ast.IfStatement:
+		next := b.branches(ast.ChildBlocks(node), from)
+		if node.Alternative == nil {
+			next = append(next, from...)
+		}
+		return next
+
+	case *ast.MatchStatement:
+		next := b.branches(ast.ChildBlocks(node), from)
+		wildcard := false
+		for _, matchCase := range node.Cases {
+			wildcard = wildcard || matchCase.Value == nil
+		}
+		if !wildcard {
+			next = append(next, from...)
+		}
+		return next
+
+	case *ast.SequenceStatement:
+		// ONCE does nothing after every option has run
+		next := b.branches(node.Options, from)
+		if node.Token.Type == token.ONCE {
+			next = append(next, from...)
+		}
+		return next
+
+	case *ast.ForStatement:
+		// A loop over an empty list skips the body
+		return slices.Concat(b.block(node.Body.Statements, from), from)
+
+	case *ast.IncludeStatement, *ast.BlockStatement:
+		return b.branches(ast.ChildBlocks(node), from)
+
+	default:
+		return from
+	}
+}
+
+// branches follows each block from the same point and returns the edges
+// leaving any of them
+func (b *builder) branches(blocks []*ast.BlockStatement, from []pending) []pending {
+	var next []pending
+	for _, block := range blocks {
+		next = append(next, b.block(block.Statements, from)...)
+	}
+	return next
+}
+
+// enter connects the edges to a node and continues from it
+func (b *builder) enter(from []pending, node *Node) []pending {
+	b.connect(from, node, FlowEdge)
+	return []pending{{from: node}}
+}
+
+func (b *builder) connect(from []pending, to *Node, kind EdgeKind) {
+	for _, edge := range from {
+		added := Edge{From: edge.from.ID, To: to.ID, Kind: kind, Label: edge.label}
+		if !b.edges[added] {
+			b.edges[added] = true
+			b.graph.Edges = append(b.graph.Edges, added)
+		}
+	}
+}
+
+func unique(from []pending) []pending {
+	var kept []pending
+	for _, edge := range from {
+		duplicate := false
+		for _, other := range kept {
+			duplicate = duplicate || other == edge
+		}
+		if !duplicate {
+			kept = append(kept, edge)
+		}
+	}
+	return kept
+}
+
+// optionLabel writes the text of a choice option without quotes, followed by
+// its tags. Text that is not a plain string is written as in the script.
+func optionLabel(text ast.Expression, tags *ast.TagList) string {
+	switch node := text.(type) {
+	case *ast.StringLiteral:
+		return tagLabel(node.Value, tags)
+	case *ast.InterpolatedString:
+		return tagLabel(strings.TrimSuffix(strings.TrimPrefix(formatter.Expression(node), "\""), "\""), tags)
+	default:
+		return tagLabel(formatter.Expression(text), tags)
+	}
+}
+
+func tagLabel(label string, tags *ast.TagList) string {
+	if tags == nil || len(tags.Tags) == 0 {
+		return label
+	}
+	names := make([]string, len(tags.Tags))
+	for idx, tag := range tags.Tags {
+		names[idx] = tag.Value
+	}
+	return strings.TrimSpace(label + " [" + strings.Join(names, ", ") + "]")
+}
+
+// resolveName looks up a label or scene name in the namespace of the file it
+// is used in, falling back to names declared outside of any file
+func resolveName[T any](declared map[string]T, name *ast.Identifier) string {
+	qualified := ast.QualifiedName(name.Token.File, name.Value)
+	if _, exists := declared[qualified]; exists {
+		return qualified
+	}
+	return name.Value
+}
@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DOT writes the graph in the Graphviz DOT language
+func (g *Graph) DOT() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "digraph %s {\n", dotString(g.Name))
+	builder.WriteString("    node [shape=box];\n")
+
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&builder, "    %s [label=%s, shape=%s];\n", node.ID, dotString(node.Label), dotShapes[node.Kind])
+	}
+
+	for _, edge := range g.Edges {
+		var attributes []string
+		if edge.Label != "" {
+			attributes = append(attributes, "label="+dotString(edge.Label))
+		}
+		if style := dotStyles[edge.Kind]; style != "" {
+			attributes = append(attributes, "style="+style)
+		}
+
+		fmt.Fprintf(&builder, "    %s -> %s", edge.From, edge.To)
+		if len(attributes) > 0 {
+			fmt.Fprintf(&builder, " [%s]", strings.Join(attributes, ", "))
+		}
+		builder.WriteString(";\n")
+	}
+
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+var dotShapes = map[NodeKind]string{
+	StartNode:  "circle",
+	EndNode:    "doublecircle",
+	LabelNode:  "box",
+	ChoiceNode: "diamond",
+	RandomNode: "hexagon",
+	SceneNode:  "component",
+}
+
+var dotStyles = map[EdgeKind]string{
+	GotoEdge: "dashed",
+	CallEdge: "bold",
+}
+
+func dotString(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(text) + `"`
+}
+
+// Mermaid writes the graph as a Mermaid flowchart
+func (g *Graph) Mermaid() string {
+	var builder strings.Builder
+	builder.WriteString("flowchart TD\n")
+
+	for _, node := range g.Nodes {
+		shape := mermaidShapes[node.Kind]
+		fmt.Fprintf(&builder, "    %s%s%s%s\n", node.ID, shape[0], mermaidString(node.Label), shape[1])
+	}
+
+	for _, edge := range g.Edges {
+		arrow := mermaidArrows[edge.Kind]
+		if edge.Label != "" {
+			arrow += "|" + mermaidString(edge.Label) + "|"
+		}
+		fmt.Fprintf(&builder, "    %s %s %s\n", edge.From, arrow, edge.To)
+	}
+
+	return builder.String()
+}
+
+var mermaidShapes = map[NodeKind][2]string{
+	StartNode:  {"((", "))"},
+	EndNode:    {"(((", ")))"},
+	LabelNode:  {"[", "]"},
+	ChoiceNode: {"{", "}"},
+	RandomNode: {"{{", "}}"},
+	SceneNode:  {"[[", "]]"},
+}
+
+var mermaidArrows = map[EdgeKind]string{
+	FlowEdge: "-->",
+	GotoEdge: "-.->",
+	CallEdge: "==>",
+	EndEdge:  "-->",
+}
+
+// mermaidString quotes text, Mermaid writes quotes and other special
+// characters as entity codes
+func mermaidString(text string) string {
+	replacer := strings.NewReplacer(`"`, "#quot;", "\n", " ")
+	return `"` + replacer.Replace(text) + `"`
+}
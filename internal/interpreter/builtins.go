@@ -0,0 +1,140 @@
+package interpreter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// builtins is the standard library of pure functions. They are called with
+// the tool call syntax, such as <upper; name>, but never reach the host.
+var builtins = []*tool{
+	{name: "length", params: []ValueType{AnyValue}, fn: builtinLength},
+	{name: "upper", params: []ValueType{StringValue}, fn: builtinUpper},
+	{name: "lower", params: []ValueType{StringValue}, fn: builtinLower},
+	{name: "contains", params: []ValueType{StringValue, StringValue}, fn: builtinContains},
+	{name: "substring", params: []ValueType{StringValue, IntValue, IntValue}, fn: builtinSubstring},
+	{name: "format", params: []ValueType{StringValue, AnyValue}, variadic: true, fn: builtinFormat},
+}
+
+// registerBuiltins registers the built-in functions. Hosts can replace them by
+// registering a tool with the same name.
+func (i *Interpreter) registerBuiltins() {
+	for _, builtin := range builtins {
+		i.tools[builtin.name] = builtin
+	}
+}
+
+// BuiltinNames returns the names of the built-in functions in sorted order
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for _, builtin := range builtins {
+		names = append(names, builtin.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// builtinLength returns the number of characters in a string or items in a list or map
+func builtinLength(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return int64(len(v)), nil
+	case map[string]interface{}:
+		return int64(len(v)), nil
+	default:
+		return nil, fmt.Errorf("cannot get the length of %s", valueTypeOf(v))
+	}
+}
+
+func builtinUpper(args []interface{}) (interface{}, error) {
+	return strings.ToUpper(args[0].(string)), nil
+}
+
+func builtinLower(args []interface{}) (interface{}, error) {
+	return strings.ToLower(args[0].(string)), nil
+}
+
+func builtinContains(args []interface{}) (interface{}, error) {
+	return strings.Contains(args[0].(string), args[1].(string)), nil
+}
+
+// builtinSubstring returns the characters from start up to, but not including, end
+func builtinSubstring(args []interface{}) (interface{}, error) {
+	runes := []rune(args[0].(string))
+	start, end := args[1].(int64), args[2].(int64)
+
+	if start < 0 || end < start || end > int64(len(runes)) {
+		return nil, fmt.Errorf("range %d to %d is out of bounds for a string of length %d", start, end, len(runes))
+	}
+
+	return string(runes[start:end]), nil
+}
+
+// formatVerb matches a verb of format with an optional '-' or '0' flag, width
+// and precision, such as %s, %03d or %.2f
+var formatVerb = regexp.MustCompile(`^%[-0]?[0-9]{0,2}(\.[0-9]{1,2})?[a-zA-Z%]`)
+
+// builtinFormat formats its arguments like a small part of fmt.Sprintf, such
+// as <format; "%.1f", meter>. Only %s for strings, %d for ints, %f for
+// numbers and %% are allowed, so Go's own verbs and error texts never end up
+// in dialog.
+func builtinFormat(args []interface{}) (interface{}, error) {
+	format := args[0].(string)
+	values := args[1:]
+
+	var result strings.Builder
+	used := 0
+	for idx := 0; idx < len(format); idx++ {
+		if format[idx] != '%' {
+			result.WriteByte(format[idx])
+			continue
+		}
+
+		verb := formatVerb.FindString(format[idx:])
+		if verb == "" {
+			return nil, fmt.Errorf("invalid verb at position %d of the format, use %%s, %%d, %%f or %%%%", idx+1)
+		}
+		idx += len(verb) - 1
+
+		if verb == "%%" {
+			result.WriteByte('%')
+			continue
+		}
+		if used == len(values) {
+			return nil, fmt.Errorf("the format has more verbs than the %d values given", len(values))
+		}
+		value := values[used]
+		used++
+
+		switch verb[len(verb)-1] {
+		case 's':
+			if _, ok := value.(string); !ok {
+				return nil, fmt.Errorf("%s needs a string, got %s", verb, valueTypeOf(value))
+			}
+		case 'd':
+			if _, ok := value.(int64); !ok {
+				return nil, fmt.Errorf("%s needs an int, got %s", verb, valueTypeOf(value))
+			}
+		case 'f':
+			if integer, ok := value.(int64); ok {
+				value = float64(integer)
+			}
+			if _, ok := value.(float64); !ok {
+				return nil, fmt.Errorf("%s needs a number, got %s", verb, valueTypeOf(value))
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported, use %%s, %%d, %%f or %%%%", verb)
+		}
+		result.WriteString(fmt.Sprintf(verb, value))
+	}
+
+	if used < len(values) {
+		return nil, fmt.Errorf("the format uses %d of the %d values given", used, len(values))
+	}
+	return result.String(), nil
+}
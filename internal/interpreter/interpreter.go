@@ -2,9 +2,12 @@ package interpreter
 
 import (
 	"fmt"
-	"math/rand"
+	"math"
+	"math/rand/v2"
 	"quill/internal/ast"
 	"quill/internal/token"
+	"strconv"
+	"strings"
 )
 
 type ResultType int
@@ -28,6 +31,8 @@ type DialogData struct {
 	Tags      []string `json:"tags"`
 }
 
+// ChoiceOption is an option presented to the player. Index is the position of
+// the option in its CHOICE block, so it stays the same when options are hidden.
 type ChoiceOption struct {
 	Index int      `json:"index"`
 	Text  string   `json:"text"`
@@ -54,21 +59,59 @@ const (
 )
 
 type executionFrame struct {
-	statements []ast.Statement
-	index      int
+	block *ast.BlockStatement
+	index int
+	loop  *loopState // set when the frame was pushed by a FOR loop
+}
+
+// loopState is the progress of a FOR loop through its items
+type loopState struct {
+	statement *ast.ForStatement
+	items     []interface{}
+	next      int
+}
+
+// callFrame is where execution continues once a called scene is finished
+type callFrame struct {
+	scene *ast.SceneStatement
+	stack []executionFrame
+	block *ast.BlockStatement
+	index int
 }
 
 type Interpreter struct {
-	program           *ast.Program
-	labels            map[string]*ast.LabelStatement
-	variables         map[string]interface{}
-	state             ExecutionState
-	currentStatements []ast.Statement
-	statementIndex    int
-	pendingChoice     *ast.ChoiceStatement
-	pendingToolCall   *ast.ToolCall
-	pendingAssignment *ast.Identifier // Variable to assign tool call result to
-	executionStack    []executionFrame
+	program         *ast.Program
+	root            *ast.BlockStatement // Top level statements of the program
+	labels          map[string]*ast.LabelStatement
+	scenes          map[string]*ast.SceneStatement
+	options         map[string]*ast.ChoiceOption // Named choice options
+	paths           *nodePaths
+	variables       map[string]interface{}
+	state           ExecutionState
+	currentBlock    *ast.BlockStatement
+	statementIndex  int
+	pendingChoice   *ast.ChoiceStatement
+	pendingOptions  []ChoiceOption // Options presented for the pending choice
+	pendingToolCall *ToolCallData
+	executionStack  []executionFrame
+	returnStack     []callFrame
+	tools           map[string]*tool
+	toolResults     []interface{} // Tool call results of the statement being executed
+	toolCursor      int
+	textPicks       []int // Options picked by {~a|b} in the statement being executed
+	textPickCursor  int
+	resuming        bool                        // The next statement is re-run after a tool call response
+	chosen          map[*ast.ChoiceOption]int   // How often each choice option was chosen
+	visits          map[*ast.LabelStatement]int // How often each label was reached
+	turns           int                         // Number of choices made
+	source          *rand.PCG
+	rng             *rand.Rand
+	sequences       map[*ast.SequenceStatement]*sequenceState
+	floatPrecision  int // Decimals shown when a float is turned into text, -1 for as many as needed
+	trace           func(ast.Statement)
+	randomPick      func(*ast.RandomStatement, []*ast.RandomOption) int
+	stepLimit       int // Statements that may run without a pause, 0 for no limit
+	unpausedSteps   int
 }
 
 type InterpreterError struct {
@@ -79,23 +122,100 @@ type InterpreterError struct {
 type ErrorData struct {
 	Message string `json:"message"`
 	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Offset  int    `json:"offset"`
 }
 
-func New(program *ast.Program) *Interpreter {
+// errorAt returns a runtime error at a token of the script
+func errorAt(at token.Token, message string) *InterpreterResult {
+	return &InterpreterResult{
+		Type: ErrorResult,
+		Data: ErrorData{
+			Message: message,
+			Line:    at.Line,
+			Column:  at.Column,
+			Offset:  at.Offset,
+		},
+	}
+}
+
+// Option configures an interpreter created with New
+type Option func(*Interpreter)
+
+// WithSeed seeds the interpreter's random number generator, so RANDOM blocks
+// pick the same options every time the script is run with the same choices
+func WithSeed(seed uint64) Option {
+	return func(i *Interpreter) {
+		i.Seed(seed)
+	}
+}
+
+// WithFloatPrecision sets the number of decimals shown when a float is used in
+// dialog or choice text. By default as many decimals as needed are shown.
+func WithFloatPrecision(decimals int) Option {
+	return func(i *Interpreter) {
+		i.floatPrecision = decimals
+	}
+}
+
+// WithTrace calls trace with every statement before it runs, so tools can
+// measure which parts of a script a playthrough reaches
+func WithTrace(trace func(ast.Statement)) Option {
+	return func(i *Interpreter) {
+		i.trace = trace
+	}
+}
+
+// WithRandomPick lets pick decide which option of a RANDOM block runs instead
+// of the random number generator. It gets the options whose condition holds
+// and returns the index of one of them.
+func WithRandomPick(pick func(random *ast.RandomStatement, available []*ast.RandomOption) int) Option {
+	return func(i *Interpreter) {
+		i.randomPick = pick
+	}
+}
+
+// WithStepLimit stops the script with an error when it runs more than limit
+// statements without showing dialog or waiting for input, as a loop of GOTOs
+// that never pauses would run forever
+func WithStepLimit(limit int) Option {
+	return func(i *Interpreter) {
+		i.stepLimit = limit
+	}
+}
+
+func New(program *ast.Program, options ...Option) *Interpreter {
+	root := &ast.BlockStatement{Statements: program.Statements}
+
+	declared := collectDeclarations(program.Statements)
+
 	interpreter := &Interpreter{
-		program:           program,
-		labels:            make(map[string]*ast.LabelStatement),
-		variables:         make(map[string]interface{}),
-		state:             StateReady,
-		currentStatements: program.Statements,
-		statementIndex:    0,
-		executionStack:    make([]executionFrame, 0),
+		program:        program,
+		root:           root,
+		labels:         declared.labels,
+		scenes:         declared.scenes,
+		options:        declared.options,
+		paths:          indexPaths(root),
+		variables:      make(map[string]interface{}),
+		state:          StateReady,
+		currentBlock:   root,
+		statementIndex: 0,
+		executionStack: make([]executionFrame, 0),
+		returnStack:    make([]callFrame, 0),
+		tools:          make(map[string]*tool),
+		chosen:         make(map[*ast.ChoiceOption]int),
+		visits:         make(map[*ast.LabelStatement]int),
+		sequences:      make(map[*ast.SequenceStatement]*sequenceState),
+		floatPrecision: -1,
 	}
 
-	interpreter.collectLabels()
+	interpreter.registerBuiltins()
+	interpreter.source = rand.NewPCG(rand.Uint64(), rand.Uint64())
+	interpreter.rng = rand.New(interpreter.source)
 
-	// Note: As of Go 1.20, rand.Seed is deprecated and no longer needed
-	// The default source is automatically seeded with a random value
+	for _, option := range options {
+		option(interpreter)
+	}
 
 	return interpreter
 }
@@ -108,8 +228,13 @@ func (i *Interpreter) executeStatement(stmt ast.Statement) *InterpreterResult {
 		return i.executeAssignStatement(node)
 	case *ast.IfStatement:
 		return i.executeIfStatement(node)
+	case *ast.MatchStatement:
+		return i.executeMatch(node)
+	case *ast.ForStatement:
+		return i.executeFor(node)
 	case *ast.LabelStatement:
-		// Labels are just markers, don't do anything special
+		// Labels are just markers, they only count how often they are reached
+		i.visits[node]++
 		return nil
 	case *ast.DialogStatement:
 		return i.executeDialog(node)
@@ -117,8 +242,19 @@ func (i *Interpreter) executeStatement(stmt ast.Statement) *InterpreterResult {
 		return i.executeChoice(node)
 	case *ast.RandomStatement:
 		return i.executeRandom(node)
+	case *ast.SequenceStatement:
+		return i.executeSequence(node)
 	case *ast.GotoStatement:
 		return i.executeGoto(node)
+	case *ast.SceneStatement:
+		// Scenes only run when called
+		return nil
+	case *ast.CallStatement:
+		return i.executeCall(node)
+	case *ast.IncludeStatement:
+		return i.executeBlock(node.Body)
+	case *ast.ReturnStatement:
+		return i.executeReturn(node)
 	case *ast.EndStatement:
 		i.state = StateEnded
 		return &InterpreterResult{
@@ -129,45 +265,12 @@ func (i *Interpreter) executeStatement(stmt ast.Statement) *InterpreterResult {
 		return i.executeBlock(node)
 	default:
 		i.state = StateError
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "unknown statement type",
-				Line:    i.getStatementLine(stmt),
-			},
-		}
+		return errorAt(ast.StatementToken(stmt), "unknown statement type")
 	}
 }
 
 func (i *Interpreter) executeLetStatement(letStmt *ast.LetStatement) *InterpreterResult {
-	// Check if the value is a tool call
-	if toolCall, ok := letStmt.Value.(*ast.ToolCall); ok {
-		// Evaluate arguments
-		var args []interface{}
-		for _, arg := range toolCall.Arguments {
-			value, err := i.evaluateExpression(arg)
-			if err != nil {
-				return err
-			}
-			args = append(args, value)
-		}
-
-		// Store context for when we get the response
-		i.pendingToolCall = toolCall
-		i.pendingAssignment = letStmt.Name
-		i.state = StateWaitingForToolCall
-		// Don't decrement statement index - we'll complete this statement when we get the response
-
-		return &InterpreterResult{
-			Type: ToolCallResult,
-			Data: ToolCallData{
-				Function:  toolCall.Function,
-				Arguments: args,
-			},
-		}
-	}
-
-	// Regular expression evaluation
+	// Tool calls without a registered tool pause here until the host responds
 	value, err := i.evaluateExpression(letStmt.Value)
 	if err != nil {
 		return err
@@ -180,13 +283,7 @@ func (i *Interpreter) executeLetStatement(letStmt *ast.LetStatement) *Interprete
 func (i *Interpreter) executeAssignStatement(assignStmt *ast.AssignStatement) *InterpreterResult {
 	currentValue, exists := i.variables[assignStmt.Name.Value]
 	if !exists {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Variable '" + assignStmt.Name.Value + "' not defined",
-				Line:    assignStmt.Name.Token.Line,
-			},
-		}
+		return errorAt(assignStmt.Name.Token, "Variable '"+assignStmt.Name.Value+"' not defined")
 	}
 
 	newValue, err := i.evaluateExpression(assignStmt.Value)
@@ -197,76 +294,92 @@ func (i *Interpreter) executeAssignStatement(assignStmt *ast.AssignStatement) *I
 	switch assignStmt.Operator.Type {
 	case token.ASSIGN:
 		i.variables[assignStmt.Name.Value] = newValue
-	case token.PLUS_ASSIGN:
-		if currentInt, ok := currentValue.(int64); ok {
-			if newInt, ok := newValue.(int64); ok {
-				i.variables[assignStmt.Name.Value] = currentInt + newInt
-			} else {
-				return &InterpreterResult{
-					Type: ErrorResult,
-					Data: ErrorData{
-						Message: "Cannot add non-integer to integer",
-						Line:    assignStmt.Operator.Line,
-					},
-				}
-			}
-		}
-	case token.MINUS_ASSIGN:
-		if currentInt, ok := currentValue.(int64); ok {
-			if newInt, ok := newValue.(int64); ok {
-				i.variables[assignStmt.Name.Value] = currentInt - newInt
-			} else {
-				return &InterpreterResult{
-					Type: ErrorResult,
-					Data: ErrorData{
-						Message: "Cannot subtract non-integer from integer",
-						Line:    assignStmt.Operator.Line,
-					},
-				}
-			}
+	case token.PLUS_ASSIGN, token.MINUS_ASSIGN:
+		result, err := addValues(assignStmt.Operator, currentValue, newValue)
+		if err != nil {
+			return err
 		}
+		i.variables[assignStmt.Name.Value] = result
 	}
 
 	return nil // Continue to next statement
 }
 
 func (i *Interpreter) executeIfStatement(ifStmt *ast.IfStatement) *InterpreterResult {
-	condition, err := i.evaluateExpression(ifStmt.Condition)
+	conditionBool, err := i.evaluateCondition(ifStmt.Condition, "IF condition", ifStmt.Token)
 	if err != nil {
 		return err
 	}
 
-	conditionBool, ok := condition.(bool)
-	if !ok {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "IF condition must be a boolean",
-				Line:    ifStmt.Token.Line,
-			},
+	if conditionBool {
+		return i.executeBlock(ifStmt.Consequence)
+	}
+
+	for _, elseIf := range ifStmt.ElseIfs {
+		conditionBool, err := i.evaluateCondition(elseIf.Condition, "ELSE IF condition", elseIf.Token)
+		if err != nil {
+			return err
+		}
+
+		if conditionBool {
+			return i.executeBlock(elseIf.Consequence)
 		}
 	}
 
-	if conditionBool {
-		return i.executeBlock(ifStmt.Consequence)
-	} else if ifStmt.Alternative != nil {
+	if ifStmt.Alternative != nil {
 		return i.executeBlock(ifStmt.Alternative)
 	}
 
 	return nil // Continue to next statement
 }
 
+func (i *Interpreter) executeMatch(match *ast.MatchStatement) *InterpreterResult {
+	value, err := i.evaluateExpression(match.Value)
+	if err != nil {
+		return err
+	}
+
+	for _, matchCase := range match.Cases {
+		if matchCase.Value == nil {
+			return i.executeBlock(matchCase.Body)
+		}
+
+		caseValue, err := i.evaluateExpression(matchCase.Value)
+		if err != nil {
+			return err
+		}
+
+		if valuesEqual(value, caseValue) {
+			return i.executeBlock(matchCase.Body)
+		}
+	}
+
+	return nil // No case matched, continue to next statement
+}
+
+// evaluateCondition evaluates an expression that has to result in a boolean
+func (i *Interpreter) evaluateCondition(expr ast.Expression, description string, at token.Token) (bool, *InterpreterResult) {
+	condition, err := i.evaluateExpression(expr)
+	if err != nil {
+		return false, err
+	}
+
+	conditionBool, ok := condition.(bool)
+	if !ok {
+		return false, errorAt(at, description+" must be a boolean")
+	}
+
+	return conditionBool, nil
+}
+
 func (i *Interpreter) executeDialog(dialog *ast.DialogStatement) *InterpreterResult {
 	character := dialog.Character.Value
 
-	// Evaluate the text expression (handles both StringLiteral and InterpolatedString)
-	textResult, err := i.evaluateExpression(dialog.Text)
+	text, err := i.evaluateText(dialog.Text)
 	if err != nil {
 		return err
 	}
 
-	text := textResult.(string)
-
 	// Extract tags if present
 	var tags []string
 	if dialog.Tags != nil && len(dialog.Tags.Tags) > 0 {
@@ -286,21 +399,38 @@ func (i *Interpreter) executeDialog(dialog *ast.DialogStatement) *InterpreterRes
 	}
 }
 
+// evaluateText evaluates the text of a dialog or choice option, which is a
+// StringLiteral or an InterpolatedString
+func (i *Interpreter) evaluateText(text ast.Expression) (string, *InterpreterResult) {
+	value, err := i.evaluateExpression(text)
+	if err != nil {
+		return "", err
+	}
+	return i.valueToString(value), nil
+}
+
 func (i *Interpreter) executeChoice(choice *ast.ChoiceStatement) *InterpreterResult {
-	options := make([]ChoiceOption, len(choice.Options))
+	options := make([]ChoiceOption, 0, len(choice.Options))
 
 	for idx, option := range choice.Options {
-		text := ""
+		// Once-only options are gone after they have been chosen
+		if option.Once && i.chosen[option] > 0 {
+			continue
+		}
 
-		// Handle both regular strings and interpolated strings
-		if stringLit, ok := option.Text.(*ast.StringLiteral); ok {
-			text = i.interpolateString(stringLit.Value)
-		} else if interpolated, ok := option.Text.(*ast.InterpolatedString); ok {
-			result, err := i.evaluateExpression(interpolated)
+		if option.Condition != nil {
+			available, err := i.evaluateCondition(option.Condition, "Choice option condition", choice.Token)
 			if err != nil {
 				return err
 			}
-			text = result.(string)
+			if !available {
+				continue
+			}
+		}
+
+		text, err := i.evaluateText(option.Text)
+		if err != nil {
+			return err
 		}
 
 		var tags []string
@@ -311,15 +441,21 @@ func (i *Interpreter) executeChoice(choice *ast.ChoiceStatement) *InterpreterRes
 			}
 		}
 
-		options[idx] = ChoiceOption{
+		options = append(options, ChoiceOption{
 			Index: idx,
 			Text:  text,
 			Tags:  tags,
-		}
+		})
+	}
+
+	// Nothing to choose from, continue after the CHOICE
+	if len(options) == 0 {
+		return nil
 	}
 
 	// Store choice and wait for input
 	i.pendingChoice = choice
+	i.pendingOptions = options
 	i.state = StateWaitingForChoice
 
 	return &InterpreterResult{
@@ -333,21 +469,71 @@ func (i *Interpreter) executeChoice(choice *ast.ChoiceStatement) *InterpreterRes
 func (i *Interpreter) executeRandom(random *ast.RandomStatement) *InterpreterResult {
 	if len(random.Options) == 0 {
 		i.state = StateError
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "RANDOM block has no options",
-				Line:    random.Token.Line,
-			},
+		return errorAt(random.Token, "RANDOM block has no options")
+	}
+
+	// All conditions are evaluated before picking, so a paused tool call
+	// does not use up a random number
+	var available []*ast.RandomOption
+	var totalWeight int64
+	for _, option := range random.Options {
+		if option.Condition != nil {
+			ok, err := i.evaluateCondition(option.Condition, "Random option condition", random.Token)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		available = append(available, option)
+		totalWeight += randomWeight(option)
+	}
+
+	// Nothing to pick from, continue after the RANDOM
+	if len(available) == 0 {
+		return nil
+	}
+
+	if i.randomPick != nil {
+		return i.executeBlock(available[i.randomPick(random, available)].Body)
+	}
+
+	// Pick a random option, options with a higher weight are picked more often
+	pick := i.rng.Int64N(totalWeight)
+	for _, option := range available {
+		pick -= randomWeight(option)
+		if pick < 0 {
+			// Execute the selected option's body
+			return i.executeBlock(option.Body)
 		}
 	}
 
-	// Pick a random option
-	selectedIndex := rand.Intn(len(random.Options))
-	selectedOption := random.Options[selectedIndex]
+	return nil
+}
 
-	// Execute the selected option's body
-	return i.executeBlock(selectedOption.Body)
+// pickText picks one of the options of {~a|b}. Picks made before the
+// statement paused for a tool call are replayed in order, so running it again
+// does not use up another random number.
+func (i *Interpreter) pickText(options int) int {
+	if i.textPickCursor < len(i.textPicks) {
+		pick := i.textPicks[i.textPickCursor]
+		i.textPickCursor++
+		return pick
+	}
+
+	pick := i.rng.IntN(options)
+	i.textPicks = append(i.textPicks, pick)
+	i.textPickCursor++
+	return pick
+}
+
+func randomWeight(option *ast.RandomOption) int64 {
+	if option.Weight == nil {
+		return 1
+	}
+	return option.Weight.Value
 }
 
 func (i *Interpreter) executeBlock(block *ast.BlockStatement) *InterpreterResult {
@@ -357,108 +543,226 @@ func (i *Interpreter) executeBlock(block *ast.BlockStatement) *InterpreterResult
 
 	// Push current context to stack
 	i.executionStack = append(i.executionStack, executionFrame{
-		statements: i.currentStatements,
-		index:      i.statementIndex,
+		block: i.currentBlock,
+		index: i.statementIndex,
 	})
 
 	// Set up new execution context
-	i.currentStatements = block.Statements
+	i.currentBlock = block
 	i.statementIndex = 0
 
 	return i.Step()
 }
 
+func (i *Interpreter) executeFor(forStmt *ast.ForStatement) *InterpreterResult {
+	iterable, err := i.evaluateExpression(forStmt.Iterable)
+	if err != nil {
+		return err
+	}
+
+	items, ok := iterationItems(iterable)
+	if !ok {
+		return errorAt(forStmt.Token, "FOR can only loop over a list or map, got "+valueTypeOf(iterable).String())
+	}
+
+	if len(items) == 0 {
+		return nil // Nothing to loop over, continue to next statement
+	}
+
+	loop := &loopState{
+		statement: forStmt,
+		items:     items,
+	}
+
+	// The loop is kept in the frame, so the body is run again when it ends
+	i.executionStack = append(i.executionStack, executionFrame{
+		block: i.currentBlock,
+		index: i.statementIndex,
+		loop:  loop,
+	})
+
+	i.nextIteration(loop)
+	return i.Step()
+}
+
+// nextIteration assigns the next item of a loop and starts its body
+func (i *Interpreter) nextIteration(loop *loopState) {
+	i.variables[loop.statement.Variable.Value] = loop.items[loop.next]
+	loop.next++
+
+	i.currentBlock = loop.statement.Body
+	i.statementIndex = 0
+}
+
 func (i *Interpreter) executeGoto(gotoStmt *ast.GotoStatement) *InterpreterResult {
 	labelName := gotoStmt.Label.Value
-	label, exists := i.labels[labelName]
+	label, exists := i.labels[resolveName(i.labels, gotoStmt.Label)]
 	if !exists {
 		i.state = StateError
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "label '" + labelName + "' not found",
-				Line:    gotoStmt.Token.Line,
-			},
+		return errorAt(gotoStmt.Token, "label '"+labelName+"' not found")
+	}
+
+	// The stack built for the jump has no loop state to continue a FOR with
+	if loop := i.enclosingLoop(label); loop != nil {
+		i.state = StateError
+		return errorAt(gotoStmt.Token, "label '"+labelName+"' is inside the FOR loop at line "+strconv.Itoa(loop.Token.Line)+" and cannot be jumped to")
+	}
+
+	stack, target, scene := i.framesTo(label)
+
+	if scene != nil {
+		// Labels inside a scene can only be reached while that scene is running
+		if len(i.returnStack) == 0 || i.returnStack[len(i.returnStack)-1].scene != scene {
+			i.state = StateError
+			return errorAt(gotoStmt.Token, "label '"+labelName+"' is inside SCENE '"+scene.Name.Value+"' and cannot be reached from outside it")
 		}
+	} else {
+		// Jumping to the main script leaves all called scenes
+		i.returnStack = make([]callFrame, 0)
 	}
 
-	// Find the index of this label in the program
-	labelIndex := -1
-	for idx, stmt := range i.program.Statements {
-		if stmt == label {
-			labelIndex = idx
-			break
+	// Replace execution stack and jump to label
+	i.executionStack = stack
+	i.currentBlock = target.block
+	i.statementIndex = target.index // Don't add 1 here, Step() will increment it
+
+	return i.Step()
+}
+
+// framesTo builds the execution stack that leads to a statement, as if every
+// enclosing block had been entered normally. It stops at the body of the
+// innermost enclosing scene and returns that scene, or nil for the main script.
+func (i *Interpreter) framesTo(stmt ast.Statement) ([]executionFrame, executionFrame, *ast.SceneStatement) {
+	blockPath, index := splitStatementPath(i.paths.statementPaths[stmt])
+	target := executionFrame{
+		block: i.paths.blocks[blockPath],
+		index: index,
+	}
+
+	var stack []executionFrame
+	for blockPath != "" {
+		ownerPath := blockOwnerPath(blockPath)
+		if scene, ok := i.paths.statements[ownerPath].(*ast.SceneStatement); ok {
+			return stack, target, scene
 		}
+
+		blockPath, index = splitStatementPath(ownerPath)
+		stack = append([]executionFrame{{
+			block: i.paths.blocks[blockPath],
+			index: index + 1,
+		}}, stack...)
 	}
 
-	if labelIndex == -1 {
-		i.state = StateError
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "label '" + labelName + "' not found in program",
-				Line:    label.Token.Line,
-			},
+	return stack, target, nil
+}
+
+// enclosingLoop returns the innermost FOR loop whose body holds a statement,
+// or nil if there is none
+func (i *Interpreter) enclosingLoop(stmt ast.Statement) *ast.ForStatement {
+	blockPath, _ := splitStatementPath(i.paths.statementPaths[stmt])
+	for blockPath != "" {
+		ownerPath := blockOwnerPath(blockPath)
+		if loop, ok := i.paths.statements[ownerPath].(*ast.ForStatement); ok {
+			return loop
 		}
+		blockPath, _ = splitStatementPath(ownerPath)
+	}
+	return nil
+}
+
+func (i *Interpreter) executeCall(call *ast.CallStatement) *InterpreterResult {
+	scene, exists := i.scenes[resolveName(i.scenes, call.Scene)]
+	if !exists {
+		i.state = StateError
+		return errorAt(call.Token, "scene '"+call.Scene.Value+"' not found")
 	}
 
-	// Clear execution stack and jump to label
+	// Remember where to continue once the scene is finished
+	i.returnStack = append(i.returnStack, callFrame{
+		scene: scene,
+		stack: i.executionStack,
+		block: i.currentBlock,
+		index: i.statementIndex,
+	})
+
 	i.executionStack = make([]executionFrame, 0)
-	i.currentStatements = i.program.Statements
-	i.statementIndex = labelIndex // Don't add 1 here, Step() will increment it
+	i.currentBlock = scene.Body
+	i.statementIndex = 0
 
 	return i.Step()
 }
 
-func (i *Interpreter) collectLabels() {
-	for _, stmt := range i.program.Statements {
-		i.collectLabelsFromStatement(stmt)
+func (i *Interpreter) executeReturn(returnStmt *ast.ReturnStatement) *InterpreterResult {
+	if len(i.returnStack) == 0 {
+		i.state = StateError
+		return errorAt(returnStmt.Token, "RETURN used outside of a SCENE")
 	}
+
+	i.returnFromScene()
+	return i.Step()
 }
 
-func (i *Interpreter) collectLabelsFromStatement(stmt ast.Statement) {
-	switch node := stmt.(type) {
-	case *ast.LabelStatement:
-		i.labels[node.Name.Value] = node
-	case *ast.ChoiceStatement:
-		for _, option := range node.Options {
-			i.collectLabelsFromBlock(option.Body)
-		}
-	case *ast.RandomStatement:
-		for _, option := range node.Options {
-			i.collectLabelsFromBlock(option.Body)
-		}
-	case *ast.BlockStatement:
-		i.collectLabelsFromBlock(node)
+func (i *Interpreter) returnFromScene() {
+	frame := i.returnStack[len(i.returnStack)-1]
+	i.returnStack = i.returnStack[:len(i.returnStack)-1]
+	i.executionStack = frame.stack
+	i.currentBlock = frame.block
+	i.statementIndex = frame.index
+}
+
+// Labels returns the labels of a program by their qualified name, the map
+// GOTO looks them up in
+func Labels(program *ast.Program) map[string]*ast.LabelStatement {
+	return collectDeclarations(program.Statements).labels
+}
+
+// declarations are the labels, scenes and named choice options of a program
+// by their qualified name
+type declarations struct {
+	labels  map[string]*ast.LabelStatement
+	scenes  map[string]*ast.SceneStatement
+	options map[string]*ast.ChoiceOption
+}
+
+func collectDeclarations(statements []ast.Statement) *declarations {
+	collected := &declarations{
+		labels:  make(map[string]*ast.LabelStatement),
+		scenes:  make(map[string]*ast.SceneStatement),
+		options: make(map[string]*ast.ChoiceOption),
 	}
+	collected.collect(statements)
+	return collected
 }
 
-func (i *Interpreter) collectLabelsFromBlock(block *ast.BlockStatement) {
-	for _, stmt := range block.Statements {
-		i.collectLabelsFromStatement(stmt)
+func (d *declarations) collect(statements []ast.Statement) {
+	for _, stmt := range statements {
+		switch node := stmt.(type) {
+		case *ast.LabelStatement:
+			d.labels[ast.QualifiedName(node.Token.File, node.Name.Value)] = node
+		case *ast.SceneStatement:
+			d.scenes[ast.QualifiedName(node.Token.File, node.Name.Value)] = node
+		case *ast.ChoiceStatement:
+			for _, option := range node.Options {
+				if option.Name != nil {
+					d.options[ast.QualifiedName(option.Name.Token.File, option.Name.Value)] = option
+				}
+			}
+		}
+
+		for _, block := range ast.ChildBlocks(stmt) {
+			d.collect(block.Statements)
+		}
 	}
 }
 
-// Helper function to get line number from statement
-func (i *Interpreter) getStatementLine(stmt ast.Statement) int {
-	switch node := stmt.(type) {
-	case *ast.LabelStatement:
-		return node.Token.Line
-	case *ast.DialogStatement:
-		return node.Character.Token.Line
-	case *ast.ChoiceStatement:
-		return node.Token.Line
-	case *ast.RandomStatement:
-		return node.Token.Line
-	case *ast.GotoStatement:
-		return node.Token.Line
-	case *ast.EndStatement:
-		return node.Token.Line
-	case *ast.BlockStatement:
-		return node.Token.Line
-	default:
-		return 0
+// resolveName looks up a label or scene name in the namespace of the file it is
+// used in, falling back to names declared outside of any file
+func resolveName[T any](declared map[string]T, name *ast.Identifier) string {
+	qualified := ast.QualifiedName(name.Token.File, name.Value)
+	if _, exists := declared[qualified]; exists {
+		return qualified
 	}
+	return name.Value
 }
 
 func (i *Interpreter) Step() *InterpreterResult {
@@ -470,44 +774,37 @@ func (i *Interpreter) Step() *InterpreterResult {
 	}
 
 	if i.state == StateError {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Interpreter in error state",
-				Line:    0,
-			},
-		}
+		return errorAt(token.Token{}, "Interpreter in error state")
 	}
 
 	if i.state == StateWaitingForChoice {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Cannot step while waiting for choice input",
-				Line:    0,
-			},
-		}
+		return errorAt(token.Token{}, "Cannot step while waiting for choice input")
 	}
 
 	if i.state == StateWaitingForToolCall {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Cannot step while waiting for tool call response",
-				Line:    0,
-			},
-		}
+		return errorAt(token.Token{}, "Cannot step while waiting for tool call response")
 	}
 
 	// Execute next statement
-	if i.statementIndex >= len(i.currentStatements) {
+	if i.statementIndex >= len(i.currentBlock.Statements) {
 		// No more statements, check if we can pop from stack
 		if len(i.executionStack) > 0 {
 			frame := i.executionStack[len(i.executionStack)-1]
+
+			// A FOR loop runs its body again while it has items left
+			if frame.loop != nil && frame.loop.next < len(frame.loop.items) {
+				i.nextIteration(frame.loop)
+				return i.Step()
+			}
+
 			i.executionStack = i.executionStack[:len(i.executionStack)-1]
-			i.currentStatements = frame.statements
+			i.currentBlock = frame.block
 			i.statementIndex = frame.index
 			return i.Step()
+		} else if len(i.returnStack) > 0 {
+			// End of a called scene, continue after the CALL
+			i.returnFromScene()
+			return i.Step()
 		} else {
 			// Program completed
 			i.state = StateEnded
@@ -518,9 +815,32 @@ func (i *Interpreter) Step() *InterpreterResult {
 		}
 	}
 
-	stmt := i.currentStatements[i.statementIndex]
+	stmt := i.currentBlock.Statements[i.statementIndex]
 	i.statementIndex++
 
+	// Keep the tool call results and text picks only when re-running a paused statement
+	if i.resuming {
+		i.resuming = false
+	} else {
+		i.toolResults = nil
+		i.textPicks = nil
+	}
+	i.toolCursor = 0
+	i.textPickCursor = 0
+
+	if i.stepLimit > 0 {
+		i.unpausedSteps++
+		if i.unpausedSteps > i.stepLimit {
+			i.state = StateError
+			at := ast.StatementToken(stmt)
+			return errorAt(at, fmt.Sprintf("Ran %d statements without a pause, the script seems to loop forever", i.stepLimit))
+		}
+	}
+
+	if i.trace != nil {
+		i.trace(stmt)
+	}
+
 	result := i.executeStatement(stmt)
 
 	// If executeStatement returns nil (like for labels), continue to next statement
@@ -528,33 +848,33 @@ func (i *Interpreter) Step() *InterpreterResult {
 		return i.Step()
 	}
 
+	i.unpausedSteps = 0
 	return result
 }
 
 func (i *Interpreter) HandleChoiceInput(choiceIndex int) *InterpreterResult {
 	if i.state != StateWaitingForChoice || i.pendingChoice == nil {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Not waiting for choice input",
-				Line:    0,
-			},
-		}
+		return errorAt(token.Token{}, "Not waiting for choice input")
 	}
 
-	if choiceIndex < 0 || choiceIndex >= len(i.pendingChoice.Options) {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Invalid choice index",
-				Line:    i.pendingChoice.Token.Line,
-			},
+	available := false
+	for _, option := range i.pendingOptions {
+		if option.Index == choiceIndex {
+			available = true
+			break
 		}
 	}
 
+	if !available {
+		return errorAt(i.pendingChoice.Token, "Invalid choice index")
+	}
+
 	// Execute the selected choice's body
 	selectedOption := i.pendingChoice.Options[choiceIndex]
+	i.chosen[selectedOption]++
+	i.turns++
 	i.pendingChoice = nil
+	i.pendingOptions = nil
 	i.state = StateReady
 
 	// Push current execution context and execute choice body
@@ -563,29 +883,26 @@ func (i *Interpreter) HandleChoiceInput(choiceIndex int) *InterpreterResult {
 
 func (i *Interpreter) HandleToolCallResponse(result interface{}) *InterpreterResult {
 	if i.state != StateWaitingForToolCall || i.pendingToolCall == nil {
-		return &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Not waiting for tool call response",
-				Line:    0,
-			},
-		}
+		return errorAt(token.Token{}, "Not waiting for tool call response")
 	}
 
-	// Store the result in the pending assignment variable
-	if i.pendingAssignment != nil {
-		i.variables[i.pendingAssignment.Value] = result
-	}
+	// The paused statement runs again on the next step and picks up the result
+	i.toolResults = append(i.toolResults, normalizeValue(result))
+	i.resuming = true
 
 	// Clear pending state
 	i.pendingToolCall = nil
-	i.pendingAssignment = nil
 	i.state = StateReady
 
-	// Return nil to indicate the LET statement is now complete and execution should continue
+	// Return nil to indicate the tool call is complete and execution should continue
 	return nil
 }
 
+// Seed resets the random number generator used by RANDOM blocks
+func (i *Interpreter) Seed(seed uint64) {
+	i.source.Seed(seed, seed)
+}
+
 // Helper methods for external use
 func (i *Interpreter) GetState() ExecutionState {
 	return i.state
@@ -608,19 +925,16 @@ func (i *Interpreter) evaluateExpression(expr ast.Expression) (interface{}, *Int
 	case *ast.Identifier:
 		value, exists := i.variables[node.Value]
 		if !exists {
-			return nil, &InterpreterResult{
-				Type: ErrorResult,
-				Data: ErrorData{
-					Message: "Variable '" + node.Value + "' not defined",
-					Line:    node.Token.Line,
-				},
-			}
+			return nil, errorAt(node.Token, "Variable '"+node.Value+"' not defined")
 		}
 		return value, nil
 
 	case *ast.IntegerLiteral:
 		return node.Value, nil
 
+	case *ast.FloatLiteral:
+		return node.Value, nil
+
 	case *ast.BooleanLiteral:
 		return node.Value, nil
 
@@ -630,33 +944,36 @@ func (i *Interpreter) evaluateExpression(expr ast.Expression) (interface{}, *Int
 	case *ast.InterpolatedString:
 		result := ""
 		for _, part := range node.Parts {
-			if ident, ok := part.(*ast.Identifier); ok {
-				// Variable interpolation
-				value, exists := i.variables[ident.Value]
-				if !exists {
-					return nil, &InterpreterResult{
-						Type: ErrorResult,
-						Data: ErrorData{
-							Message: "Variable '" + ident.Value + "' not defined",
-							Line:    ident.Token.Line,
-						},
-					}
-				}
-				result += i.valueToString(value)
-			} else if str, ok := part.(*ast.StringLiteral); ok {
-				// String literal part
+			// Text parts are used as they are, everything else was written in braces
+			if str, ok := part.(*ast.StringLiteral); ok {
 				result += str.Value
-			} else if toolCall, ok := part.(*ast.ToolCall); ok {
-				// Tool call interpolation
-				toolResult, err := i.executeToolCallImmediate(toolCall)
-				if err != nil {
-					return nil, err
-				}
-				result += i.valueToString(toolResult)
+				continue
+			}
+
+			value, err := i.evaluateExpression(part)
+			if err != nil {
+				return nil, err
 			}
+			result += i.valueToString(value)
 		}
 		return result, nil
 
+	case *ast.ConditionalText:
+		condition, err := i.evaluateCondition(node.Condition, "Inline IF condition", node.Token)
+		if err != nil {
+			return nil, err
+		}
+		if condition {
+			return i.evaluateExpression(node.Consequence)
+		}
+		if node.Alternative == nil {
+			return "", nil
+		}
+		return i.evaluateExpression(node.Alternative)
+
+	case *ast.AlternativeText:
+		return i.evaluateExpression(node.Options[i.pickText(len(node.Options))])
+
 	case *ast.InfixExpression:
 		return i.evaluateInfixExpression(node)
 
@@ -664,28 +981,54 @@ func (i *Interpreter) evaluateExpression(expr ast.Expression) (interface{}, *Int
 		return i.evaluatePrefixExpression(node)
 
 	case *ast.ToolCall:
-		// For tool calls in expressions (like interpolated strings), we need immediate execution
-		// Only LET statements pause for tool calls
-		return i.executeToolCallImmediate(node)
+		return i.evaluateToolCall(node)
+
+	case *ast.VisitsExpression:
+		return i.evaluateVisits(node)
+
+	case *ast.ListLiteral:
+		return i.evaluateListLiteral(node)
+
+	case *ast.MapLiteral:
+		return i.evaluateMapLiteral(node)
+
+	case *ast.IndexExpression:
+		return i.evaluateIndexExpression(node)
+
+	case *ast.TurnsExpression:
+		return int64(i.turns), nil
 
 	default:
-		return nil, &InterpreterResult{
-			Type: ErrorResult,
-			Data: ErrorData{
-				Message: "Unknown expression type",
-				Line:    0,
-			},
-		}
+		return nil, errorAt(token.Token{}, "Unknown expression type")
 	}
 }
 
+func (i *Interpreter) evaluateVisits(expr *ast.VisitsExpression) (interface{}, *InterpreterResult) {
+	if label, exists := i.labels[resolveName(i.labels, expr.Name)]; exists {
+		return int64(i.visits[label]), nil
+	}
+
+	if option, exists := i.options[resolveName(i.options, expr.Name)]; exists {
+		return int64(i.chosen[option]), nil
+	}
+
+	return nil, errorAt(expr.Token, "No label or choice option named '"+expr.Name.Value+"'")
+}
+
 func (i *Interpreter) evaluateInfixExpression(expr *ast.InfixExpression) (interface{}, *InterpreterResult) {
 	// Special handling for null coalescing operator
 	if expr.Operator == "??" {
 		left, err := i.evaluateExpression(expr.Left)
+		if err != nil && err.Type == ToolCallResult {
+			// Waiting for the host is not a failure
+			return nil, err
+		}
 		if err != nil {
 			// If left side fails, evaluate right side
 			right, err2 := i.evaluateExpression(expr.Right)
+			if err2 != nil && err2.Type == ToolCallResult {
+				return nil, err2
+			}
 			if err2 != nil {
 				return nil, err // Return the original left error
 			}
@@ -716,44 +1059,40 @@ func (i *Interpreter) evaluateInfixExpression(expr *ast.InfixExpression) (interf
 
 	switch expr.Operator {
 	case "==":
-		return left == right, nil
+		return valuesEqual(left, right), nil
 	case "!=":
-		return left != right, nil
-	case "+":
-		if leftInt, ok := left.(int64); ok {
-			if rightInt, ok := right.(int64); ok {
-				return leftInt + rightInt, nil
-			}
-		}
-	case "-":
-		if leftInt, ok := left.(int64); ok {
-			if rightInt, ok := right.(int64); ok {
-				return leftInt - rightInt, nil
-			}
-		}
-	case ">":
+		return !valuesEqual(left, right), nil
+	case "+", "-", "*", "/", "%", ">", "<", ">=", "<=":
+		// Integer operations stay integers, an int and a float give a float
 		if leftInt, ok := left.(int64); ok {
 			if rightInt, ok := right.(int64); ok {
-				return leftInt > rightInt, nil
+				return i.evaluateIntegerInfix(expr, leftInt, rightInt)
 			}
 		}
-	case "<":
-		if leftInt, ok := left.(int64); ok {
-			if rightInt, ok := right.(int64); ok {
-				return leftInt < rightInt, nil
+		if leftFloat, ok := toFloat(left); ok {
+			if rightFloat, ok := toFloat(right); ok {
+				return i.evaluateFloatInfix(expr, leftFloat, rightFloat)
 			}
 		}
-	case ">=":
-		if leftInt, ok := left.(int64); ok {
-			if rightInt, ok := right.(int64); ok {
-				return leftInt >= rightInt, nil
+		if leftString, ok := left.(string); ok {
+			if rightString, ok := right.(string); ok {
+				switch expr.Operator {
+				case "+":
+					return leftString + rightString, nil
+				case ">":
+					return leftString > rightString, nil
+				case "<":
+					return leftString < rightString, nil
+				case ">=":
+					return leftString >= rightString, nil
+				case "<=":
+					return leftString <= rightString, nil
+				}
 			}
 		}
-	case "<=":
-		if leftInt, ok := left.(int64); ok {
-			if rightInt, ok := right.(int64); ok {
-				return leftInt <= rightInt, nil
-			}
+	case "IN":
+		if contained, ok := containsValue(right, left); ok {
+			return contained, nil
 		}
 	case "&&":
 		if leftBool, ok := left.(bool); ok {
@@ -769,163 +1108,203 @@ func (i *Interpreter) evaluateInfixExpression(expr *ast.InfixExpression) (interf
 		}
 	}
 
-	return nil, &InterpreterResult{
-		Type: ErrorResult,
-		Data: ErrorData{
-			Message: "Invalid operation: " + expr.Operator,
-			Line:    expr.Token.Line,
-		},
-	}
+	return nil, errorAt(expr.Token, "Invalid operation: "+expr.Operator)
 }
 
-func (i *Interpreter) evaluatePrefixExpression(expr *ast.PrefixExpression) (interface{}, *InterpreterResult) {
-	right, err := i.evaluateExpression(expr.Right)
-	if err != nil {
-		return nil, err
+func (i *Interpreter) evaluateIntegerInfix(expr *ast.InfixExpression, left int64, right int64) (interface{}, *InterpreterResult) {
+	switch expr.Operator {
+	case "+", "-", "*", "/", "%":
+		if right == 0 && (expr.Operator == "/" || expr.Operator == "%") {
+			return nil, errorAt(expr.Token, "Division by zero")
+		}
+		result, fits := intArithmetic(expr.Operator, left, right)
+		if !fits {
+			return nil, errorAt(expr.Token, "Result of '"+expr.Operator+"' is too large for a number")
+		}
+		return result, nil
+	case ">":
+		return left > right, nil
+	case "<":
+		return left < right, nil
+	case ">=":
+		return left >= right, nil
+	default: // "<="
+		return left <= right, nil
 	}
+}
 
+func (i *Interpreter) evaluateFloatInfix(expr *ast.InfixExpression, left float64, right float64) (interface{}, *InterpreterResult) {
+	var result float64
 	switch expr.Operator {
-	case "!":
-		if rightBool, ok := right.(bool); ok {
-			return !rightBool, nil
+	case "+":
+		result = left + right
+	case "-":
+		result = left - right
+	case "*":
+		result = left * right
+	case "/", "%":
+		if right == 0 {
+			return nil, errorAt(expr.Token, "Division by zero")
 		}
+		if expr.Operator == "/" {
+			result = left / right
+		} else {
+			result = math.Mod(left, right)
+		}
+	case ">":
+		return left > right, nil
+	case "<":
+		return left < right, nil
+	case ">=":
+		return left >= right, nil
+	default: // "<="
+		return left <= right, nil
 	}
 
-	return nil, &InterpreterResult{
-		Type: ErrorResult,
-		Data: ErrorData{
-			Message: "Invalid prefix operation: " + expr.Operator,
-			Line:    expr.Token.Line,
-		},
+	if !finite(result) {
+		return nil, errorAt(expr.Token, "Result of '"+expr.Operator+"' is too large for a number")
 	}
+	return result, nil
 }
 
-func (i *Interpreter) valueToString(value interface{}) string {
-	switch v := value.(type) {
-	case string:
-		return v
-	case int64:
-		return fmt.Sprintf("%d", v)
-	case bool:
-		if v {
-			return "TRUE"
+// addValues adds or subtracts two values for += or -= with the same rules as
+// + and -, lists and maps can also be changed with them
+func addValues(operator token.Token, left interface{}, right interface{}) (interface{}, *InterpreterResult) {
+	subtract := operator.Type == token.MINUS_ASSIGN
+	if result, ok := addToCollection(left, right, subtract); ok {
+		return result, nil
+	}
+
+	if leftString, ok := left.(string); ok && !subtract {
+		if rightString, ok := right.(string); ok {
+			return leftString + rightString, nil
 		}
-		return "FALSE"
-	default:
-		return fmt.Sprintf("%v", v)
 	}
-}
 
-func (interp *Interpreter) interpolateString(text string) string {
-	result := ""
-	for i := 0; i < len(text); i++ {
-		if text[i] == '{' {
-			// Find the closing brace
-			j := i + 1
-			for j < len(text) && text[j] != '}' {
-				j++
+	if leftInt, ok := left.(int64); ok {
+		if rightInt, ok := right.(int64); ok {
+			arithmetic := "+"
+			if subtract {
+				arithmetic = "-"
 			}
-
-			if j < len(text) {
-				// Extract variable name and substitute
-				varName := text[i+1 : j]
-				if value, exists := interp.variables[varName]; exists {
-					result += interp.valueToString(value)
-				} else {
-					// Variable not found, keep the original text
-					result += "{" + varName + "}"
-				}
-				i = j // Skip past the closing brace
-			} else {
-				// No closing brace found, add the character as-is
-				result += string(text[i])
+			result, fits := intArithmetic(arithmetic, leftInt, rightInt)
+			if !fits {
+				return nil, errorAt(operator, "Result of '"+operator.Lexeme+"' is too large for a number")
 			}
-		} else {
-			result += string(text[i])
+			return result, nil
 		}
 	}
-	return result
-}
 
-func (i *Interpreter) executeToolCallImmediate(toolCall *ast.ToolCall) (interface{}, *InterpreterResult) {
-	// Evaluate all arguments first
-	var args []interface{}
-	for _, arg := range toolCall.Arguments {
-		value, err := i.evaluateExpression(arg)
-		if err != nil {
-			return nil, err
+	leftFloat, leftOk := toFloat(left)
+	rightFloat, rightOk := toFloat(right)
+	if !leftOk || !rightOk {
+		if subtract {
+			return nil, errorAt(operator, "Cannot subtract "+valueTypeOf(right).String()+" from "+valueTypeOf(left).String())
 		}
-		args = append(args, value)
+		return nil, errorAt(operator, "Cannot add "+valueTypeOf(right).String()+" to "+valueTypeOf(left).String())
 	}
 
-	// Execute immediately with mock data
-	result := i.callTool(toolCall.Function, args)
+	result := leftFloat + rightFloat
+	if subtract {
+		result = leftFloat - rightFloat
+	}
+	if !finite(result) {
+		return nil, errorAt(operator, "Result of '"+operator.Lexeme+"' is too large for a number")
+	}
 	return result, nil
 }
 
-func (i *Interpreter) callTool(functionName string, args []interface{}) interface{} {
-	// Mock implementation of tool calls
-	// In a real system, this would interface with external APIs, databases, etc.
-
-	switch functionName {
-	case "getPlayerName":
-		// Return a default player name or from some external system
-		return "Player"
-
-	case "getPlayerAge":
-		// Return a default age or from some external system
-		return int64(25)
-
-	case "getData":
-		// Simulate getting data based on the first argument
-		if len(args) > 0 {
-			key := i.valueToString(args[0])
-			switch key {
-			case "gold":
-				return int64(100)
-			case "health":
-				return int64(80)
-			default:
-				return "Unknown"
-			}
-		}
-		return "No data"
+// toFloat converts a number to a float, ints are promoted
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
 
-	case "getItemPrice":
-		// Simulate getting item price based on item type and level
-		if len(args) >= 2 {
-			itemType := i.valueToString(args[0])
-			level, ok := args[1].(int64)
-			if !ok {
-				level = 1
-			}
+// valuesEqual compares two values, an int and a float are equal if they have the same value
+func valuesEqual(left interface{}, right interface{}) bool {
+	switch l := left.(type) {
+	case []interface{}:
+		r, ok := right.([]interface{})
+		return ok && listsEqual(l, r)
+	case map[string]interface{}:
+		r, ok := right.(map[string]interface{})
+		return ok && mapsEqual(l, r)
+	}
+	switch right.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
 
-			// Simple price calculation: base price * level
-			basePrice := int64(10)
-			if itemType == "potion" {
-				basePrice = 5
-			} else if itemType == "weapon" {
-				basePrice = 50
-			} else if itemType == "armor" {
-				basePrice = 30
-			}
+	_, leftIsFloat := left.(float64)
+	_, rightIsFloat := right.(float64)
+	if leftIsFloat || rightIsFloat {
+		leftFloat, leftOk := toFloat(left)
+		rightFloat, rightOk := toFloat(right)
+		return leftOk && rightOk && leftFloat == rightFloat
+	}
 
-			return basePrice * level
-		}
-		return int64(0)
+	return left == right
+}
+
+func (i *Interpreter) evaluatePrefixExpression(expr *ast.PrefixExpression) (interface{}, *InterpreterResult) {
+	right, err := i.evaluateExpression(expr.Right)
+	if err != nil {
+		return nil, err
+	}
 
-	case "agePlusFive":
-		// Add 5 to the age argument
-		if len(args) > 0 {
-			if age, ok := args[0].(int64); ok {
-				return age + 5
+	switch expr.Operator {
+	case "!":
+		if rightBool, ok := right.(bool); ok {
+			return !rightBool, nil
+		}
+	case "-":
+		if rightInt, ok := right.(int64); ok {
+			if rightInt == math.MinInt64 {
+				return nil, errorAt(expr.Token, "Result of '-' is too large for a number")
 			}
+			return -rightInt, nil
+		}
+		if rightFloat, ok := right.(float64); ok {
+			return -rightFloat, nil
 		}
-		return int64(5)
+	}
+
+	return nil, errorAt(expr.Token, "Invalid prefix operation: "+expr.Operator)
+}
 
+func (i *Interpreter) valueToString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return fmt.Sprintf("%d", v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', i.floatPrecision, 64)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case []interface{}:
+		elements := make([]string, 0, len(v))
+		for _, element := range v {
+			elements = append(elements, i.valueToString(element))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case map[string]interface{}:
+		entries := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			entries = append(entries, key+": "+i.valueToString(v[key]))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
 	default:
-		// Unknown function, return a placeholder
-		return "Unknown function: " + functionName
+		return fmt.Sprintf("%v", v)
 	}
 }
 
@@ -937,8 +1316,14 @@ func (i *Interpreter) isFalsy(value interface{}) bool {
 		return !v
 	case int64:
 		return v == 0
+	case float64:
+		return v == 0
 	case string:
 		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
 	default:
 		return false
 	}
@@ -0,0 +1,112 @@
+package interpreter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"quill/internal/ast"
+	"strconv"
+	"strings"
+)
+
+// nodePaths addresses blocks and statements by their position in the program.
+// The top level block has the empty path, statement n of a block is "<block>/n"
+// (or just "n" at the top level) and child block k of a statement is "<statement>.k".
+type nodePaths struct {
+	blocks         map[string]*ast.BlockStatement
+	blockPaths     map[*ast.BlockStatement]string
+	statements     map[string]ast.Statement
+	statementPaths map[ast.Statement]string
+	shapes         map[*ast.BlockStatement]string
+}
+
+func indexPaths(root *ast.BlockStatement) *nodePaths {
+	paths := &nodePaths{
+		blocks:         make(map[string]*ast.BlockStatement),
+		blockPaths:     make(map[*ast.BlockStatement]string),
+		statements:     make(map[string]ast.Statement),
+		statementPaths: make(map[ast.Statement]string),
+		shapes:         make(map[*ast.BlockStatement]string),
+	}
+
+	paths.indexBlock(root, "")
+	return paths
+}
+
+func (np *nodePaths) indexBlock(block *ast.BlockStatement, path string) {
+	np.blocks[path] = block
+	np.blockPaths[block] = path
+	np.shapes[block] = blockShape(block)
+
+	for idx, stmt := range block.Statements {
+		stmtPath := statementPath(path, idx)
+		np.statements[stmtPath] = stmt
+		np.statementPaths[stmt] = stmtPath
+
+		for k, child := range ast.ChildBlocks(stmt) {
+			if child != nil {
+				np.indexBlock(child, stmtPath+"."+strconv.Itoa(k))
+			}
+		}
+	}
+}
+
+// blockShape fingerprints the statements of a block by their kind, their
+// number of child blocks and the names of labels and scenes
+func blockShape(block *ast.BlockStatement) string {
+	hash := fnv.New64a()
+	for _, stmt := range block.Statements {
+		fmt.Fprintf(hash, "%T/%d", stmt, len(ast.ChildBlocks(stmt)))
+		switch node := stmt.(type) {
+		case *ast.LabelStatement:
+			fmt.Fprintf(hash, "/%s", node.Name.Value)
+		case *ast.SceneStatement:
+			fmt.Fprintf(hash, "/%s", node.Name.Value)
+		}
+		hash.Write([]byte{0})
+	}
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+func statementPath(blockPath string, index int) string {
+	if blockPath == "" {
+		return strconv.Itoa(index)
+	}
+	return blockPath + "/" + strconv.Itoa(index)
+}
+
+// splitStatementPath returns the path of the block containing a statement and
+// the statement's index in it
+func splitStatementPath(path string) (string, int) {
+	blockPath := ""
+	if slash := strings.LastIndex(path, "/"); slash != -1 {
+		blockPath = path[:slash]
+		path = path[slash+1:]
+	}
+
+	index, _ := strconv.Atoi(path)
+	return blockPath, index
+}
+
+// choiceOption returns the choice option whose body is at path, or nil
+func (np *nodePaths) choiceOption(path string) *ast.ChoiceOption {
+	dot := strings.LastIndex(path, ".")
+	if dot == -1 {
+		return nil
+	}
+
+	choice, ok := np.statements[path[:dot]].(*ast.ChoiceStatement)
+	if !ok {
+		return nil
+	}
+
+	index, err := strconv.Atoi(path[dot+1:])
+	if err != nil || index < 0 || index >= len(choice.Options) {
+		return nil
+	}
+	return choice.Options[index]
+}
+
+// blockOwnerPath returns the path of the statement a nested block belongs to
+func blockOwnerPath(path string) string {
+	return path[:strings.LastIndex(path, ".")]
+}
@@ -0,0 +1,62 @@
+package interpreter
+
+import (
+	"quill/internal/ast"
+	"quill/internal/token"
+)
+
+// sequenceState is how often a sequence has been reached and, for SHUFFLE,
+// the order of its options in the current round
+type sequenceState struct {
+	count int
+	order []int
+}
+
+func (i *Interpreter) executeSequence(sequence *ast.SequenceStatement) *InterpreterResult {
+	state, exists := i.sequences[sequence]
+	if !exists {
+		state = &sequenceState{}
+		i.sequences[sequence] = state
+	}
+
+	size := len(sequence.Options)
+	index := -1
+
+	switch sequence.Token.Type {
+	case token.CYCLE:
+		index = state.count % size
+	case token.STOPPING:
+		index = min(state.count, size-1)
+	case token.ONCE:
+		if state.count < size {
+			index = state.count
+		}
+	case token.SHUFFLE:
+		if state.count%size == 0 || len(state.order) != size {
+			state.order = i.shuffleOrder(size, state.order)
+		}
+		index = state.order[state.count%size]
+	}
+
+	state.count++
+
+	// ONCE sequences do nothing after every option has run
+	if index == -1 {
+		return nil
+	}
+
+	return i.executeBlock(sequence.Options[index])
+}
+
+// shuffleOrder returns a new random order of size options. The first option
+// of the new round is never the last option of the previous one.
+func (i *Interpreter) shuffleOrder(size int, previous []int) []int {
+	order := i.rng.Perm(size)
+
+	if size > 1 && len(previous) == size && order[0] == previous[size-1] {
+		swap := 1 + i.rng.IntN(size-1)
+		order[0], order[swap] = order[swap], order[0]
+	}
+
+	return order
+}
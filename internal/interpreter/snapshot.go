@@ -0,0 +1,585 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"quill/internal/ast"
+)
+
+const snapshotVersion = 1
+
+// Snapshot is the serializable execution state of an interpreter. Blocks and
+// statements are referenced by their path in the program, so a snapshot can be
+// restored into a fresh interpreter created from the same script.
+type Snapshot struct {
+	Version         int                         `json:"version"`
+	State           ExecutionState              `json:"state"`
+	Variables       map[string]SnapshotValue    `json:"variables"`
+	Stack           []FrameSnapshot             `json:"stack"`
+	Current         FrameSnapshot               `json:"current"`
+	Calls           []CallSnapshot              `json:"calls,omitempty"`
+	PendingChoice   *ChoiceSnapshot             `json:"pending_choice,omitempty"`
+	PendingToolCall *ToolCallSnapshot           `json:"pending_tool_call,omitempty"`
+	ToolResults     []SnapshotValue             `json:"tool_results,omitempty"`
+	TextPicks       []int                       `json:"text_picks,omitempty"`
+	Resuming        bool                        `json:"resuming,omitempty"`
+	Chosen          map[string]int              `json:"chosen,omitempty"` // Keyed by the path of the option's body
+	Visits          map[string]int              `json:"visits,omitempty"` // Keyed by the path of the label
+	Turns           int                         `json:"turns,omitempty"`
+	Random          []byte                      `json:"random,omitempty"`    // State of the random number generator
+	Sequences       map[string]SequenceSnapshot `json:"sequences,omitempty"` // Keyed by the path of the sequence
+}
+
+// FrameSnapshot is a position inside a block. Size is the number of statements
+// in the block when the snapshot was taken and Shape a fingerprint of them.
+type FrameSnapshot struct {
+	Block string        `json:"block"`
+	Size  int           `json:"size"`
+	Shape string        `json:"shape"`
+	Index int           `json:"index"`
+	Loop  *LoopSnapshot `json:"loop,omitempty"`
+}
+
+// LoopSnapshot is the progress of the FOR loop that pushed a frame
+type LoopSnapshot struct {
+	Statement string          `json:"statement"`
+	Items     []SnapshotValue `json:"items"`
+	Next      int             `json:"next"`
+}
+
+// CallSnapshot is a called scene and the position to return to afterwards
+type CallSnapshot struct {
+	Scene  string          `json:"scene"`
+	Stack  []FrameSnapshot `json:"stack"`
+	Return FrameSnapshot   `json:"return"`
+}
+
+// SequenceSnapshot is the state of a CYCLE, STOPPING, SHUFFLE or ONCE block
+type SequenceSnapshot struct {
+	Size  int   `json:"size"`
+	Count int   `json:"count"`
+	Order []int `json:"order,omitempty"`
+}
+
+type ChoiceSnapshot struct {
+	Statement string         `json:"statement"`
+	Size      int            `json:"size"`
+	Options   []ChoiceOption `json:"options"`
+}
+
+type ToolCallSnapshot struct {
+	Function  string          `json:"function"`
+	Arguments []SnapshotValue `json:"arguments"`
+}
+
+// SnapshotValue is a script value tagged with its type so it survives JSON encoding
+type SnapshotValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Snapshot captures the current execution state
+func (i *Interpreter) Snapshot() (*Snapshot, error) {
+	snapshot := &Snapshot{
+		Version:   snapshotVersion,
+		State:     i.state,
+		Variables: make(map[string]SnapshotValue),
+		Stack:     make([]FrameSnapshot, 0, len(i.executionStack)),
+		TextPicks: i.textPicks,
+		Resuming:  i.resuming,
+		Turns:     i.turns,
+	}
+
+	for name, value := range i.variables {
+		encoded, err := encodeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable '%s': %w", name, err)
+		}
+		snapshot.Variables[name] = encoded
+	}
+
+	stack, err := i.snapshotStack(i.executionStack)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Stack = stack
+	snapshot.Current = i.snapshotFrame(i.currentBlock, i.statementIndex)
+
+	for _, call := range i.returnStack {
+		callStack, err := i.snapshotStack(call.stack)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Calls = append(snapshot.Calls, CallSnapshot{
+			Scene:  i.paths.statementPaths[call.scene],
+			Stack:  callStack,
+			Return: i.snapshotFrame(call.block, call.index),
+		})
+	}
+
+	if i.pendingChoice != nil {
+		snapshot.PendingChoice = &ChoiceSnapshot{
+			Statement: i.paths.statementPaths[i.pendingChoice],
+			Size:      len(i.pendingChoice.Options),
+			Options:   i.pendingOptions,
+		}
+	}
+
+	if i.pendingToolCall != nil {
+		args, err := encodeValues(i.pendingToolCall.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("tool call '%s': %w", i.pendingToolCall.Function, err)
+		}
+		snapshot.PendingToolCall = &ToolCallSnapshot{
+			Function:  i.pendingToolCall.Function,
+			Arguments: args,
+		}
+	}
+
+	for option, count := range i.chosen {
+		if snapshot.Chosen == nil {
+			snapshot.Chosen = make(map[string]int)
+		}
+		snapshot.Chosen[i.paths.blockPaths[option.Body]] = count
+	}
+
+	for label, count := range i.visits {
+		if snapshot.Visits == nil {
+			snapshot.Visits = make(map[string]int)
+		}
+		snapshot.Visits[i.paths.statementPaths[label]] = count
+	}
+
+	for sequence, state := range i.sequences {
+		if snapshot.Sequences == nil {
+			snapshot.Sequences = make(map[string]SequenceSnapshot)
+		}
+		snapshot.Sequences[i.paths.statementPaths[sequence]] = SequenceSnapshot{
+			Size:  len(sequence.Options),
+			Count: state.count,
+			Order: state.order,
+		}
+	}
+
+	random, err := i.source.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("random number generator: %w", err)
+	}
+	snapshot.Random = random
+
+	results, err := encodeValues(i.toolResults)
+	if err != nil {
+		return nil, fmt.Errorf("tool call result: %w", err)
+	}
+	snapshot.ToolResults = results
+
+	return snapshot, nil
+}
+
+// Restore replaces the execution state with a snapshot. The script may have
+// changed since the snapshot was taken, as long as every block and statement
+// it refers to still exists with the same shape.
+func (i *Interpreter) Restore(snapshot *Snapshot) error {
+	if snapshot == nil {
+		return fmt.Errorf("no snapshot to restore")
+	}
+
+	if snapshot.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	variables := make(map[string]interface{})
+	for name, encoded := range snapshot.Variables {
+		value, err := decodeValue(encoded)
+		if err != nil {
+			return fmt.Errorf("variable '%s': %w", name, err)
+		}
+		variables[name] = value
+	}
+
+	stack, err := i.restoreStack(snapshot.Stack)
+	if err != nil {
+		return err
+	}
+
+	current, err := i.restoreFrame(snapshot.Current)
+	if err != nil {
+		return err
+	}
+
+	returnStack := make([]callFrame, 0, len(snapshot.Calls))
+	for _, call := range snapshot.Calls {
+		scene, ok := i.paths.statements[call.Scene].(*ast.SceneStatement)
+		if !ok {
+			return fmt.Errorf("script changed: no matching SCENE at '%s'", call.Scene)
+		}
+
+		callStack, err := i.restoreStack(call.Stack)
+		if err != nil {
+			return err
+		}
+
+		returnTo, err := i.restoreFrame(call.Return)
+		if err != nil {
+			return err
+		}
+
+		returnStack = append(returnStack, callFrame{
+			scene: scene,
+			stack: callStack,
+			block: returnTo.block,
+			index: returnTo.index,
+		})
+	}
+
+	var pendingChoice *ast.ChoiceStatement
+	var pendingOptions []ChoiceOption
+	if snapshot.PendingChoice != nil {
+		choice, ok := i.paths.statements[snapshot.PendingChoice.Statement].(*ast.ChoiceStatement)
+		if !ok || len(choice.Options) != snapshot.PendingChoice.Size {
+			return fmt.Errorf("script changed: no matching CHOICE at '%s'", snapshot.PendingChoice.Statement)
+		}
+		for _, option := range snapshot.PendingChoice.Options {
+			if option.Index < 0 || option.Index >= len(choice.Options) {
+				return fmt.Errorf("invalid option index %d for CHOICE at '%s'", option.Index, snapshot.PendingChoice.Statement)
+			}
+		}
+		pendingChoice = choice
+		pendingOptions = snapshot.PendingChoice.Options
+	}
+
+	var pendingToolCall *ToolCallData
+	if snapshot.PendingToolCall != nil {
+		args, err := decodeValues(snapshot.PendingToolCall.Arguments)
+		if err != nil {
+			return fmt.Errorf("tool call '%s': %w", snapshot.PendingToolCall.Function, err)
+		}
+		pendingToolCall = &ToolCallData{
+			Function:  snapshot.PendingToolCall.Function,
+			Arguments: args,
+		}
+	}
+
+	toolResults, err := decodeValues(snapshot.ToolResults)
+	if err != nil {
+		return fmt.Errorf("tool call result: %w", err)
+	}
+
+	chosen := make(map[*ast.ChoiceOption]int)
+	for path, count := range snapshot.Chosen {
+		option := i.paths.choiceOption(path)
+		if option == nil {
+			return fmt.Errorf("script changed: no matching choice option at '%s'", path)
+		}
+		chosen[option] = count
+	}
+
+	visits := make(map[*ast.LabelStatement]int)
+	for path, count := range snapshot.Visits {
+		label, ok := i.paths.statements[path].(*ast.LabelStatement)
+		if !ok {
+			return fmt.Errorf("script changed: no matching LABEL at '%s'", path)
+		}
+		visits[label] = count
+	}
+
+	sequences := make(map[*ast.SequenceStatement]*sequenceState)
+	for path, saved := range snapshot.Sequences {
+		sequence, ok := i.paths.statements[path].(*ast.SequenceStatement)
+		if !ok || len(sequence.Options) != saved.Size {
+			return fmt.Errorf("script changed: no matching sequence at '%s'", path)
+		}
+		if saved.Count < 0 {
+			return fmt.Errorf("invalid count %d for sequence at '%s'", saved.Count, path)
+		}
+		for _, index := range saved.Order {
+			if len(saved.Order) != saved.Size || index < 0 || index >= saved.Size {
+				return fmt.Errorf("invalid shuffle order for sequence at '%s'", path)
+			}
+		}
+		sequences[sequence] = &sequenceState{
+			count: saved.Count,
+			order: saved.Order,
+		}
+	}
+
+	// Snapshots without a generator state keep the current one
+	source := i.source
+	if snapshot.Random != nil {
+		source = rand.NewPCG(0, 0)
+		if err := source.UnmarshalBinary(snapshot.Random); err != nil {
+			return fmt.Errorf("random number generator: %w", err)
+		}
+	}
+
+	switch snapshot.State {
+	case StateWaitingForChoice:
+		if pendingChoice == nil {
+			return fmt.Errorf("snapshot is waiting for a choice but has none")
+		}
+	case StateWaitingForToolCall:
+		if pendingToolCall == nil {
+			return fmt.Errorf("snapshot is waiting for a tool call but has none")
+		}
+	}
+
+	i.state = snapshot.State
+	i.variables = variables
+	i.executionStack = stack
+	i.returnStack = returnStack
+	i.currentBlock = current.block
+	i.statementIndex = current.index
+	i.pendingChoice = pendingChoice
+	i.pendingOptions = pendingOptions
+	i.pendingToolCall = pendingToolCall
+	i.toolResults = toolResults
+	i.toolCursor = 0
+	i.textPicks = snapshot.TextPicks
+	i.textPickCursor = 0
+	i.resuming = snapshot.Resuming
+	i.chosen = chosen
+	i.visits = visits
+	i.turns = snapshot.Turns
+	i.source = source
+	i.rng = rand.New(source)
+	i.sequences = sequences
+
+	return nil
+}
+
+// PendingResult returns the choice or tool call the interpreter is waiting
+// for, or nil if it is not waiting. Hosts use it to present the prompt again
+// after restoring a snapshot.
+func (i *Interpreter) PendingResult() *InterpreterResult {
+	switch {
+	case i.state == StateWaitingForChoice && i.pendingChoice != nil:
+		return &InterpreterResult{
+			Type: ChoiceResult,
+			Data: ChoiceData{
+				Options: i.pendingOptions,
+			},
+		}
+	case i.state == StateWaitingForToolCall && i.pendingToolCall != nil:
+		return &InterpreterResult{
+			Type: ToolCallResult,
+			Data: *i.pendingToolCall,
+		}
+	default:
+		return nil
+	}
+}
+
+func (i *Interpreter) snapshotFrame(block *ast.BlockStatement, index int) FrameSnapshot {
+	return FrameSnapshot{
+		Block: i.paths.blockPaths[block],
+		Size:  len(block.Statements),
+		Shape: i.paths.shapes[block],
+		Index: index,
+	}
+}
+
+func (i *Interpreter) snapshotStack(stack []executionFrame) ([]FrameSnapshot, error) {
+	frames := make([]FrameSnapshot, 0, len(stack))
+	for _, frame := range stack {
+		snapshot := i.snapshotFrame(frame.block, frame.index)
+
+		if frame.loop != nil {
+			items, err := encodeValues(frame.loop.items)
+			if err != nil {
+				return nil, fmt.Errorf("FOR loop: %w", err)
+			}
+			snapshot.Loop = &LoopSnapshot{
+				Statement: i.paths.statementPaths[frame.loop.statement],
+				Items:     items,
+				Next:      frame.loop.next,
+			}
+		}
+
+		frames = append(frames, snapshot)
+	}
+	return frames, nil
+}
+
+func (i *Interpreter) restoreStack(frames []FrameSnapshot) ([]executionFrame, error) {
+	stack := make([]executionFrame, 0, len(frames))
+	for _, frame := range frames {
+		restored, err := i.restoreFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, restored)
+	}
+	return stack, nil
+}
+
+func (i *Interpreter) restoreFrame(frame FrameSnapshot) (executionFrame, error) {
+	block, exists := i.paths.blocks[frame.Block]
+	if !exists || len(block.Statements) != frame.Size || i.paths.shapes[block] != frame.Shape {
+		return executionFrame{}, fmt.Errorf("script changed: no matching block at '%s'", frame.Block)
+	}
+
+	if frame.Index < 0 || frame.Index > frame.Size {
+		return executionFrame{}, fmt.Errorf("invalid statement index %d in block '%s'", frame.Index, frame.Block)
+	}
+
+	restored := executionFrame{
+		block: block,
+		index: frame.Index,
+	}
+
+	if frame.Loop != nil {
+		statement, ok := i.paths.statements[frame.Loop.Statement].(*ast.ForStatement)
+		if !ok {
+			return executionFrame{}, fmt.Errorf("script changed: no matching FOR at '%s'", frame.Loop.Statement)
+		}
+
+		items, err := decodeValues(frame.Loop.Items)
+		if err != nil {
+			return executionFrame{}, fmt.Errorf("FOR loop: %w", err)
+		}
+
+		if frame.Loop.Next < 1 || frame.Loop.Next > len(items) {
+			return executionFrame{}, fmt.Errorf("invalid FOR loop position %d at '%s'", frame.Loop.Next, frame.Loop.Statement)
+		}
+
+		restored.loop = &loopState{
+			statement: statement,
+			items:     items,
+			next:      frame.Loop.Next,
+		}
+	}
+
+	return restored, nil
+}
+
+func encodeValue(value interface{}) (SnapshotValue, error) {
+	var typeName string
+
+	switch v := value.(type) {
+	case nil:
+		return SnapshotValue{Type: "null"}, nil
+	case int64:
+		typeName = "int"
+	case float64:
+		typeName = "float"
+	case bool:
+		typeName = "bool"
+	case string:
+		typeName = "string"
+	case []interface{}:
+		elements, err := encodeValues(v)
+		if err != nil {
+			return SnapshotValue{}, err
+		}
+		if elements == nil {
+			elements = []SnapshotValue{}
+		}
+		raw, err := json.Marshal(elements)
+		return SnapshotValue{Type: "list", Value: raw}, err
+	case map[string]interface{}:
+		entries := make(map[string]SnapshotValue, len(v))
+		for key, entry := range v {
+			encoded, err := encodeValue(entry)
+			if err != nil {
+				return SnapshotValue{}, err
+			}
+			entries[key] = encoded
+		}
+		raw, err := json.Marshal(entries)
+		return SnapshotValue{Type: "map", Value: raw}, err
+	default:
+		return SnapshotValue{}, fmt.Errorf("cannot save value of type %T", value)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return SnapshotValue{}, err
+	}
+
+	return SnapshotValue{
+		Type:  typeName,
+		Value: raw,
+	}, nil
+}
+
+func decodeValue(encoded SnapshotValue) (interface{}, error) {
+	switch encoded.Type {
+	case "null":
+		return nil, nil
+	case "int":
+		var value int64
+		err := json.Unmarshal(encoded.Value, &value)
+		return value, err
+	case "float":
+		var value float64
+		err := json.Unmarshal(encoded.Value, &value)
+		return value, err
+	case "bool":
+		var value bool
+		err := json.Unmarshal(encoded.Value, &value)
+		return value, err
+	case "string":
+		var value string
+		err := json.Unmarshal(encoded.Value, &value)
+		return value, err
+	case "list":
+		var elements []SnapshotValue
+		if err := json.Unmarshal(encoded.Value, &elements); err != nil {
+			return nil, err
+		}
+		list, err := decodeValues(elements)
+		if list == nil {
+			list = []interface{}{}
+		}
+		return list, err
+	case "map":
+		var entries map[string]SnapshotValue
+		if err := json.Unmarshal(encoded.Value, &entries); err != nil {
+			return nil, err
+		}
+		decoded := make(map[string]interface{}, len(entries))
+		for key, entry := range entries {
+			value, err := decodeValue(entry)
+			if err != nil {
+				return nil, err
+			}
+			decoded[key] = value
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unknown value type '%s'", encoded.Type)
+	}
+}
+
+func encodeValues(values []interface{}) ([]SnapshotValue, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	encoded := make([]SnapshotValue, 0, len(values))
+	for _, value := range values {
+		value, err := encodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, value)
+	}
+	return encoded, nil
+}
+
+func decodeValues(encoded []SnapshotValue) ([]interface{}, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+
+	values := make([]interface{}, 0, len(encoded))
+	for _, value := range encoded {
+		decoded, err := decodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, decoded)
+	}
+	return values, nil
+}
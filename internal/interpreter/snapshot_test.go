@@ -0,0 +1,161 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"quill/internal/parsetest"
+	"reflect"
+	"testing"
+)
+
+const snapshotScript = `
+LET gold = 3
+Narrator: "You have {gold} gold."
+CHOICE {
+    "Buy a sword" {
+        gold -= 2
+        GOTO shop
+    },
+    "Leave" { END }
+}
+
+LABEL shop
+Merchant: "Fine choice, {gold} gold left."
+END
+`
+
+// untilChoice steps until the interpreter waits for a choice
+func untilChoice(t *testing.T, interp *Interpreter) {
+	t.Helper()
+
+	for {
+		result := interp.Step()
+		switch result.Type {
+		case ChoiceResult:
+			return
+		case DialogResult:
+			continue
+		default:
+			t.Fatalf("got %v before the choice", result)
+		}
+	}
+}
+
+// transcript answers the pending choice and collects the dialog up to the end
+func transcript(t *testing.T, interp *Interpreter, choice int) []DialogData {
+	t.Helper()
+
+	var lines []DialogData
+	result := interp.HandleChoiceInput(choice)
+	for result.Type != EndResult {
+		if result.Type != DialogResult {
+			t.Fatalf("got %v after the choice", result)
+		}
+		lines = append(lines, result.Data.(DialogData))
+		result = interp.Step()
+	}
+	return lines
+}
+
+func saved(t *testing.T, interp *Interpreter) *Snapshot {
+	t.Helper()
+
+	snapshot, err := interp.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Snapshot
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return &decoded
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	original := New(parsetest.Parse(t, snapshotScript))
+	untilChoice(t, original)
+	snapshot := saved(t, original)
+
+	restored := New(parsetest.Parse(t, snapshotScript))
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.IsWaitingForChoice() {
+		t.Fatalf("restored interpreter is in state %v, want it waiting for the choice", restored.GetState())
+	}
+
+	want := transcript(t, original, 0)
+	got := transcript(t, restored, 0)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored interpreter said %v, want %v", got, want)
+	}
+}
+
+func TestSnapshotRejectsChangedScript(t *testing.T) {
+	original := New(parsetest.Parse(t, snapshotScript))
+	untilChoice(t, original)
+	snapshot := saved(t, original)
+
+	// The same number of statements, but a label in place of the dialog
+	changed := New(parsetest.Parse(t, `
+LET gold = 3
+LABEL intro
+CHOICE {
+    "Buy a sword" {
+        gold -= 2
+        GOTO shop
+    },
+    "Leave" { END }
+}
+
+LABEL shop
+Merchant: "Fine choice, {gold} gold left."
+END
+`))
+	if err := changed.Restore(snapshot); err == nil {
+		t.Error("snapshot was restored into a changed script")
+	}
+}
+
+func TestSnapshotRejectsInvalidOptionIndex(t *testing.T) {
+	original := New(parsetest.Parse(t, snapshotScript))
+	untilChoice(t, original)
+	snapshot := saved(t, original)
+	snapshot.PendingChoice.Options[1].Index = 5
+
+	restored := New(parsetest.Parse(t, snapshotScript))
+	if err := restored.Restore(snapshot); err == nil {
+		t.Error("snapshot with an option index beyond the CHOICE was restored")
+	}
+}
+
+func TestSnapshotRejectsNegativeSequenceCount(t *testing.T) {
+	script := `
+LABEL hub
+CYCLE {
+    { A: "First" },
+    { A: "Second" }
+}
+CHOICE {
+    "Again" { GOTO hub }
+}
+`
+	original := New(parsetest.Parse(t, script))
+	untilChoice(t, original)
+	snapshot := saved(t, original)
+	for path, sequence := range snapshot.Sequences {
+		sequence.Count = -1
+		snapshot.Sequences[path] = sequence
+	}
+	if len(snapshot.Sequences) == 0 {
+		t.Fatal("snapshot has no sequence")
+	}
+
+	restored := New(parsetest.Parse(t, script))
+	if err := restored.Restore(snapshot); err == nil {
+		t.Error("snapshot with a negative sequence count was restored")
+	}
+}
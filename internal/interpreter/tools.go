@@ -0,0 +1,226 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"quill/internal/ast"
+	"quill/internal/token"
+	"strings"
+)
+
+// ValueType describes the type of a script value, used to check tool arguments
+type ValueType int
+
+const (
+	AnyValue ValueType = iota
+	IntValue
+	FloatValue
+	BoolValue
+	StringValue
+	ListValue
+	MapValue
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case IntValue:
+		return "int"
+	case FloatValue:
+		return "float"
+	case BoolValue:
+		return "bool"
+	case StringValue:
+		return "string"
+	case ListValue:
+		return "list"
+	case MapValue:
+		return "map"
+	default:
+		return "any"
+	}
+}
+
+// ToolFunc is a Go function that can be called from a script with <name; args>
+type ToolFunc func(args []interface{}) (interface{}, error)
+
+type tool struct {
+	name     string
+	params   []ValueType
+	variadic bool // the last parameter accepts any number of arguments
+	fn       ToolFunc
+}
+
+// RegisterTool makes fn callable from scripts under the given name. The length
+// of params is the arity of the tool and each argument is checked against its
+// type before fn is called. Tool calls that are not registered pause the
+// interpreter and are handed to the host instead.
+func (i *Interpreter) RegisterTool(name string, params []ValueType, fn ToolFunc) {
+	i.tools[name] = &tool{
+		name:   name,
+		params: params,
+		fn:     fn,
+	}
+}
+
+// HasTool reports whether a tool with the given name is registered
+func (i *Interpreter) HasTool(name string) bool {
+	_, exists := i.tools[name]
+	return exists
+}
+
+func (i *Interpreter) evaluateToolCall(toolCall *ast.ToolCall) (interface{}, *InterpreterResult) {
+	// Results gathered before the statement was paused are replayed in order
+	if i.toolCursor < len(i.toolResults) {
+		result := i.toolResults[i.toolCursor]
+		i.toolCursor++
+		if !finite(result) {
+			return nil, errorAt(toolCall.Token, "Tool '"+toolCall.Function+"' returned a number that is not finite")
+		}
+		return result, nil
+	}
+
+	// Evaluate all arguments first
+	args := make([]interface{}, 0, len(toolCall.Arguments))
+	for _, arg := range toolCall.Arguments {
+		value, err := i.evaluateExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	registered, exists := i.tools[toolCall.Function]
+	if !exists {
+		// Hand the call to the host and run the statement again once it responds
+		i.pendingToolCall = &ToolCallData{
+			Function:  toolCall.Function,
+			Arguments: args,
+		}
+		i.state = StateWaitingForToolCall
+		i.statementIndex--
+
+		return nil, &InterpreterResult{
+			Type: ToolCallResult,
+			Data: *i.pendingToolCall,
+		}
+	}
+
+	result, err := i.callTool(registered, args, toolCall.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	i.toolResults = append(i.toolResults, result)
+	i.toolCursor++
+	return result, nil
+}
+
+func (i *Interpreter) callTool(registered *tool, args []interface{}, at token.Token) (interface{}, *InterpreterResult) {
+	if registered.variadic && len(args) < len(registered.params)-1 {
+		return nil, errorAt(at, fmt.Sprintf("Tool '%s' expects at least %d arguments, got %d", registered.name, len(registered.params)-1, len(args)))
+	}
+
+	if !registered.variadic && len(args) != len(registered.params) {
+		return nil, errorAt(at, fmt.Sprintf("Tool '%s' expects %d arguments, got %d", registered.name, len(registered.params), len(args)))
+	}
+
+	for idx := range args {
+		param := registered.params[min(idx, len(registered.params)-1)]
+
+		// Ints are accepted where floats are expected
+		if param == FloatValue {
+			if argInt, ok := args[idx].(int64); ok {
+				args[idx] = float64(argInt)
+			}
+		}
+
+		if param != AnyValue && valueTypeOf(args[idx]) != param {
+			return nil, errorAt(at, fmt.Sprintf("Argument %d of tool '%s' must be %s, got %s", idx+1, registered.name, param, valueTypeOf(args[idx])))
+		}
+	}
+
+	result, err := registered.fn(args)
+	if err != nil {
+		return nil, errorAt(at, "Tool '"+registered.name+"' failed: "+err.Error())
+	}
+
+	value := normalizeValue(result)
+	if !finite(value) {
+		return nil, errorAt(at, "Tool '"+registered.name+"' returned a number that is not finite")
+	}
+	return value, nil
+}
+
+func valueTypeOf(value interface{}) ValueType {
+	switch value.(type) {
+	case int64:
+		return IntValue
+	case float64:
+		return FloatValue
+	case bool:
+		return BoolValue
+	case string:
+		return StringValue
+	case []interface{}:
+		return ListValue
+	case map[string]interface{}:
+		return MapValue
+	default:
+		return AnyValue
+	}
+}
+
+// normalizeValue converts Go values handed in by the host to the types used by scripts
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		// Numbers without a fraction or exponent stay ints, so large values keep their precision
+		if !strings.ContainsAny(string(v), ".eE") {
+			if integer, err := v.Int64(); err == nil {
+				return integer
+			}
+		}
+		if float, err := v.Float64(); err == nil {
+			return float
+		}
+		return value
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, element := range v {
+			list = append(list, normalizeValue(element))
+		}
+		return list
+	case []string:
+		list := make([]interface{}, 0, len(v))
+		for _, element := range v {
+			list = append(list, element)
+		}
+		return list
+	case map[string]interface{}:
+		entries := make(map[string]interface{}, len(v))
+		for key, entry := range v {
+			entries[key] = normalizeValue(entry)
+		}
+		return entries
+	default:
+		return value
+	}
+}
@@ -0,0 +1,271 @@
+package interpreter
+
+import (
+	"math"
+	"quill/internal/ast"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Lists are []interface{} and maps are map[string]interface{}. Both are never
+// changed in place, every change creates a new value, so variables holding the
+// same list do not affect each other.
+
+func (i *Interpreter) evaluateListLiteral(list *ast.ListLiteral) (interface{}, *InterpreterResult) {
+	elements := make([]interface{}, 0, len(list.Elements))
+	for _, element := range list.Elements {
+		value, err := i.evaluateExpression(element)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+	}
+	return elements, nil
+}
+
+func (i *Interpreter) evaluateMapLiteral(mapLiteral *ast.MapLiteral) (interface{}, *InterpreterResult) {
+	entries := make(map[string]interface{}, len(mapLiteral.Keys))
+	for idx, keyExpr := range mapLiteral.Keys {
+		key, err := i.evaluateExpression(keyExpr)
+		if err != nil {
+			return nil, err
+		}
+
+		keyString, ok := key.(string)
+		if !ok {
+			return nil, errorAt(mapLiteral.Token, "Map keys must be strings, got "+valueTypeOf(key).String())
+		}
+
+		value, err := i.evaluateExpression(mapLiteral.Values[idx])
+		if err != nil {
+			return nil, err
+		}
+		entries[keyString] = value
+	}
+	return entries, nil
+}
+
+func (i *Interpreter) evaluateIndexExpression(expr *ast.IndexExpression) (interface{}, *InterpreterResult) {
+	left, err := i.evaluateExpression(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := i.evaluateExpression(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := left.(type) {
+	case []interface{}:
+		position, ok := index.(int64)
+		if !ok {
+			return nil, errorAt(expr.Token, "List index must be an int, got "+valueTypeOf(index).String())
+		}
+		if position < 0 || position >= int64(len(container)) {
+			return nil, errorAt(expr.Token, "List index "+i.valueToString(position)+" is out of range for a list of length "+i.valueToString(int64(len(container))))
+		}
+		return container[position], nil
+
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, errorAt(expr.Token, "Map key must be a string, got "+valueTypeOf(index).String())
+		}
+		value, exists := container[key]
+		if !exists {
+			return nil, errorAt(expr.Token, "Key '"+key+"' not found in map")
+		}
+		return value, nil
+
+	default:
+		return nil, errorAt(expr.Token, "Cannot index "+valueTypeOf(left).String())
+	}
+}
+
+// finite reports whether a value and everything in it are free of Inf and
+// NaN, which scripts have no use for and JSON cannot hold
+func finite(value interface{}) bool {
+	switch v := value.(type) {
+	case float64:
+		return !math.IsInf(v, 0) && !math.IsNaN(v)
+	case []interface{}:
+		for _, element := range v {
+			if !finite(element) {
+				return false
+			}
+		}
+	case map[string]interface{}:
+		for _, entry := range v {
+			if !finite(entry) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// intArithmetic applies +, -, *, / or % to two ints and reports false when
+// the result does not fit in an int64. The divisor of / and % is not zero.
+func intArithmetic(operator string, left int64, right int64) (int64, bool) {
+	switch operator {
+	case "+":
+		result := left + right
+		return result, (result > left) == (right > 0)
+	case "-":
+		result := left - right
+		return result, (result < left) == (right > 0)
+	case "*":
+		if left == 0 || right == 0 {
+			return 0, true
+		}
+		result := left * right
+		return result, result/right == left && !(left == -1 && right == math.MinInt64) && !(right == -1 && left == math.MinInt64)
+	case "/":
+		return left / right, !(left == math.MinInt64 && right == -1)
+	default: // "%"
+		return left % right, true
+	}
+}
+
+// containsValue reports whether item is an element of a list, a key of a map
+// or a substring of a string
+func containsValue(container interface{}, item interface{}) (bool, bool) {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, element := range c {
+			if valuesEqual(element, item) {
+				return true, true
+			}
+		}
+		return false, true
+	case map[string]interface{}:
+		key, ok := item.(string)
+		if !ok {
+			return false, true
+		}
+		_, exists := c[key]
+		return exists, true
+	case string:
+		substring, ok := item.(string)
+		if !ok {
+			return false, false
+		}
+		return strings.Contains(c, substring), true
+	default:
+		return false, false
+	}
+}
+
+// addToCollection handles += and -= on lists and maps. A list gains or loses
+// an element, or all elements of another list. A map is merged with another
+// map, or loses a key.
+func addToCollection(collection interface{}, value interface{}, subtract bool) (interface{}, bool) {
+	switch c := collection.(type) {
+	case []interface{}:
+		if subtract {
+			removed := slices.Clone(c)
+			if items, ok := value.([]interface{}); ok {
+				for _, item := range items {
+					removed = removeFirst(removed, item)
+				}
+				return removed, true
+			}
+			return removeFirst(removed, value), true
+		}
+
+		if items, ok := value.([]interface{}); ok {
+			return append(slices.Clone(c), items...), true
+		}
+		return append(slices.Clone(c), value), true
+
+	case map[string]interface{}:
+		merged := make(map[string]interface{}, len(c))
+		for key, entry := range c {
+			merged[key] = entry
+		}
+
+		if subtract {
+			key, ok := value.(string)
+			if !ok {
+				return nil, false
+			}
+			delete(merged, key)
+			return merged, true
+		}
+
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		for key, entry := range entries {
+			merged[key] = entry
+		}
+		return merged, true
+
+	default:
+		return nil, false
+	}
+}
+
+func removeFirst(list []interface{}, item interface{}) []interface{} {
+	for idx, element := range list {
+		if valuesEqual(element, item) {
+			return append(list[:idx], list[idx+1:]...)
+		}
+	}
+	return list
+}
+
+// iterationItems returns the items a FOR loop runs over: the elements of a
+// list, or the keys of a map in sorted order
+func iterationItems(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return slices.Clone(v), true
+	case map[string]interface{}:
+		keys := sortedKeys(v)
+		items := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			items = append(items, key)
+		}
+		return items, true
+	default:
+		return nil, false
+	}
+}
+
+func sortedKeys(entries map[string]interface{}) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func listsEqual(left []interface{}, right []interface{}) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for idx := range left {
+		if !valuesEqual(left[idx], right[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func mapsEqual(left map[string]interface{}, right map[string]interface{}) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for key, value := range left {
+		other, exists := right[key]
+		if !exists || !valuesEqual(value, other) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package interpreter
+
+import (
+	"quill/internal/parsetest"
+	"testing"
+)
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string // empty when the script runs without an error
+	}{
+		{`LET x = 9223372036854775807 + 1`, "Result of '+' is too large for a number"},
+		{`LET x = -9223372036854775807 - 2`, "Result of '-' is too large for a number"},
+		{`LET x = 4611686018427387904 * 2`, "Result of '*' is too large for a number"},
+		{`LET x = (-9223372036854775807 - 1) / -1`, "Result of '/' is too large for a number"},
+		{`LET x = -(-9223372036854775807 - 1)`, "Result of '-' is too large for a number"},
+		{"LET x = 9223372036854775807\nx += 1", "Result of '+=' is too large for a number"},
+		{"LET x = -9223372036854775807\nx -= 2", "Result of '-=' is too large for a number"},
+		{`LET x = 9223372036854775806 + 1`, ""},
+		{`LET x = -4611686018427387904 * 2`, ""},
+		{"LET x = 9223372036854775806\nx += 1", ""},
+	}
+
+	for _, test := range tests {
+		interp := New(parsetest.Parse(t, test.source+"\nEND"))
+		result := interp.Step()
+		for result.Type != EndResult && result.Type != ErrorResult {
+			result = interp.Step()
+		}
+
+		message := ""
+		if result.Type == ErrorResult {
+			message = result.Data.(ErrorData).Message
+		}
+		if message != test.err {
+			t.Errorf("%q: got error %q, want %q", test.source, message, test.err)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package jsonapi
 
 import (
 	"encoding/json"
+	"quill/internal/checker"
 	"quill/internal/interpreter"
 	"quill/internal/parser"
 	"quill/internal/scanner"
+	"strings"
 )
 
 // JSONResult is the main wrapper for all API responses
@@ -15,15 +17,36 @@ type JSONResult struct {
 	Error   string `json:"error,omitempty"`
 }
 
+// marshal encodes a result as JSON. A result that cannot be encoded, such as
+// a tool call argument that is not a finite number, becomes an error result
+// instead of an empty string.
+func marshal(result JSONResult) string {
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		jsonBytes, _ = json.Marshal(JSONResult{
+			Success: false,
+			Type:    "encoding_error",
+			Error:   "Result cannot be encoded as JSON: " + err.Error(),
+		})
+	}
+	return string(jsonBytes)
+}
+
 // QuillInterpreter wraps the Go interpreter with JSON API
 type QuillInterpreter struct {
 	interpreter *interpreter.Interpreter
 }
 
 // NewQuillInterpreter creates a new JSON API interpreter from source code
-func NewQuillInterpreter(source string) (*QuillInterpreter, string) {
+func NewQuillInterpreter(source string, options ...interpreter.Option) (*QuillInterpreter, string) {
+	return NewQuillInterpreterWithLoader("", source, nil, options...)
+}
+
+// NewQuillInterpreterWithLoader creates a new JSON API interpreter from the
+// source of the named file, resolving INCLUDE statements with loader
+func NewQuillInterpreterWithLoader(file string, source string, loader parser.Loader, options ...interpreter.Option) (*QuillInterpreter, string) {
 	// Scan tokens
-	scanner := scanner.New(source)
+	scanner := scanner.NewWithFile(source, file)
 	tokens, scannerErrors := scanner.ScanTokens()
 
 	if len(scannerErrors) > 0 {
@@ -34,14 +57,25 @@ func NewQuillInterpreter(source string) (*QuillInterpreter, string) {
 			Error:   "Scanner errors occurred",
 		}
 
-		jsonBytes, _ := json.Marshal(result)
-		return nil, string(jsonBytes)
+		return nil, marshal(result)
 	}
 
 	// Parse program
-	parser := parser.New(tokens)
+	parser := parser.NewWithLoader(tokens, loader)
 	program, parserErrors := parser.Parse()
 
+	// Scanner errors of included files are only known after parsing
+	if len(parser.ScannerErrors()) > 0 {
+		result := JSONResult{
+			Success: false,
+			Type:    "scanner_errors",
+			Data:    parser.ScannerErrors(),
+			Error:   "Scanner errors occurred",
+		}
+
+		return nil, marshal(result)
+	}
+
 	if len(parserErrors) > 0 {
 		result := JSONResult{
 			Success: false,
@@ -50,12 +84,11 @@ func NewQuillInterpreter(source string) (*QuillInterpreter, string) {
 			Error:   "Parser errors occurred",
 		}
 
-		jsonBytes, _ := json.Marshal(result)
-		return nil, string(jsonBytes)
+		return nil, marshal(result)
 	}
 
 	// Create interpreter
-	interp := interpreter.New(program)
+	interp := interpreter.New(program, options...)
 
 	result := JSONResult{
 		Success: true,
@@ -63,8 +96,37 @@ func NewQuillInterpreter(source string) (*QuillInterpreter, string) {
 		Data:    nil,
 	}
 
-	jsonBytes, _ := json.Marshal(result)
-	return &QuillInterpreter{interpreter: interp}, string(jsonBytes)
+	return &QuillInterpreter{interpreter: interp}, marshal(result)
+}
+
+// RegisterTool registers a Go function that scripts can call without pausing for the host
+func (qi *QuillInterpreter) RegisterTool(name string, params []interpreter.ValueType, fn interpreter.ToolFunc) {
+	if qi.interpreter == nil {
+		return
+	}
+
+	qi.interpreter.RegisterTool(name, params, fn)
+}
+
+// Seed resets the random number generator used by RANDOM blocks and returns JSON
+func (qi *QuillInterpreter) Seed(seed uint64) string {
+	if qi.interpreter == nil {
+		result := JSONResult{
+			Success: false,
+			Error:   "Interpreter not initialized",
+		}
+		return marshal(result)
+	}
+
+	qi.interpreter.Seed(seed)
+
+	result := JSONResult{
+		Success: true,
+		Type:    "seeded",
+		Data:    seed,
+	}
+
+	return marshal(result)
 }
 
 // Step executes the next step in the interpreter and returns JSON
@@ -74,8 +136,7 @@ func (qi *QuillInterpreter) Step() string {
 			Success: false,
 			Error:   "Interpreter not initialized",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	interpResult := qi.interpreter.Step()
@@ -89,8 +150,7 @@ func (qi *QuillInterpreter) HandleChoiceInput(choiceIndex int) string {
 			Success: false,
 			Error:   "Interpreter not initialized",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	interpResult := qi.interpreter.HandleChoiceInput(choiceIndex)
@@ -104,8 +164,7 @@ func (qi *QuillInterpreter) GetState() string {
 			Success: false,
 			Error:   "Interpreter not initialized",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	state := qi.interpreter.GetState()
@@ -132,8 +191,7 @@ func (qi *QuillInterpreter) GetState() string {
 		Data:    stateStr,
 	}
 
-	jsonBytes, _ := json.Marshal(result)
-	return string(jsonBytes)
+	return marshal(result)
 }
 
 // IsEnded returns whether the interpreter has ended as JSON
@@ -143,8 +201,7 @@ func (qi *QuillInterpreter) IsEnded() string {
 			Success: false,
 			Error:   "Interpreter not initialized",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	result := JSONResult{
@@ -153,8 +210,7 @@ func (qi *QuillInterpreter) IsEnded() string {
 		Data:    qi.interpreter.IsEnded(),
 	}
 
-	jsonBytes, _ := json.Marshal(result)
-	return string(jsonBytes)
+	return marshal(result)
 }
 
 // IsWaitingForChoice returns whether the interpreter is waiting for choice input as JSON
@@ -164,8 +220,7 @@ func (qi *QuillInterpreter) IsWaitingForChoice() string {
 			Success: false,
 			Error:   "Interpreter not initialized",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	result := JSONResult{
@@ -174,8 +229,7 @@ func (qi *QuillInterpreter) IsWaitingForChoice() string {
 		Data:    qi.interpreter.IsWaitingForChoice(),
 	}
 
-	jsonBytes, _ := json.Marshal(result)
-	return string(jsonBytes)
+	return marshal(result)
 }
 
 // IsWaitingForToolCall returns whether the interpreter is waiting for tool call response as JSON
@@ -185,8 +239,7 @@ func (qi *QuillInterpreter) IsWaitingForToolCall() string {
 			Success: false,
 			Error:   "Interpreter not initialized",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	result := JSONResult{
@@ -195,8 +248,7 @@ func (qi *QuillInterpreter) IsWaitingForToolCall() string {
 		Data:    qi.interpreter.IsWaitingForToolCall(),
 	}
 
-	jsonBytes, _ := json.Marshal(result)
-	return string(jsonBytes)
+	return marshal(result)
 }
 
 // HandleToolCallResponse handles tool call response and returns JSON
@@ -206,8 +258,7 @@ func (qi *QuillInterpreter) HandleToolCallResponse(result interface{}) string {
 			Success: false,
 			Error:   "Interpreter not initialized",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	interpResult := qi.interpreter.HandleToolCallResponse(result)
@@ -218,13 +269,110 @@ func (qi *QuillInterpreter) HandleToolCallResponse(result interface{}) string {
 			Type:    "tool_call_completed",
 			Data:    nil,
 		}
-		jsonBytes, _ := json.Marshal(successResult)
-		return string(jsonBytes)
+		return marshal(successResult)
 	}
 
 	return qi.convertResultToJSON(interpResult)
 }
 
+// HandleToolCallResponseJSON decodes a JSON encoded tool call result and hands
+// it to the interpreter. Numbers are decoded as ints unless they have a
+// fraction or exponent, so no precision is lost on either.
+func (qi *QuillInterpreter) HandleToolCallResponseJSON(data string) string {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		result := JSONResult{
+			Success: false,
+			Type:    "invalid_tool_call_response",
+			Error:   "Invalid tool call response: " + err.Error(),
+		}
+		return marshal(result)
+	}
+
+	return qi.HandleToolCallResponse(value)
+}
+
+// Save returns the interpreter's execution state as a JSON snapshot
+func (qi *QuillInterpreter) Save() string {
+	if qi.interpreter == nil {
+		result := JSONResult{
+			Success: false,
+			Error:   "Interpreter not initialized",
+		}
+		return marshal(result)
+	}
+
+	snapshot, err := qi.interpreter.Snapshot()
+	if err != nil {
+		result := JSONResult{
+			Success: false,
+			Type:    "save_error",
+			Error:   err.Error(),
+		}
+		return marshal(result)
+	}
+
+	result := JSONResult{
+		Success: true,
+		Type:    "snapshot",
+		Data:    snapshot,
+	}
+
+	return marshal(result)
+}
+
+// Load restores a snapshot produced by Save. It accepts either the whole Save
+// result or only its data. If the restored interpreter is waiting for a choice
+// or tool call, that prompt is returned so the host can present it again.
+func (qi *QuillInterpreter) Load(data string) string {
+	if qi.interpreter == nil {
+		result := JSONResult{
+			Success: false,
+			Error:   "Interpreter not initialized",
+		}
+		return marshal(result)
+	}
+
+	raw := json.RawMessage(data)
+	var envelope struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err == nil && envelope.Type == "snapshot" {
+		raw = envelope.Data
+	}
+
+	var snapshot interpreter.Snapshot
+	err := json.Unmarshal(raw, &snapshot)
+	if err == nil {
+		err = qi.interpreter.Restore(&snapshot)
+	}
+
+	if err != nil {
+		result := JSONResult{
+			Success: false,
+			Type:    "load_error",
+			Error:   err.Error(),
+		}
+		return marshal(result)
+	}
+
+	if pending := qi.interpreter.PendingResult(); pending != nil {
+		return qi.convertResultToJSON(pending)
+	}
+
+	result := JSONResult{
+		Success: true,
+		Type:    "loaded",
+		Data:    nil,
+	}
+
+	return marshal(result)
+}
+
 // convertResultToJSON converts interpreter results to JSON format
 func (qi *QuillInterpreter) convertResultToJSON(interpResult *interpreter.InterpreterResult) string {
 	if interpResult == nil {
@@ -232,8 +380,7 @@ func (qi *QuillInterpreter) convertResultToJSON(interpResult *interpreter.Interp
 			Success: false,
 			Error:   "Received nil result from interpreter",
 		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	var resultType string
@@ -268,14 +415,19 @@ func (qi *QuillInterpreter) convertResultToJSON(interpResult *interpreter.Interp
 		}
 	}
 
-	jsonBytes, _ := json.Marshal(result)
-	return string(jsonBytes)
+	return marshal(result)
 }
 
 // ParseOnly parses source code without creating an interpreter, returns JSON
 func ParseOnly(source string) string {
+	return ParseOnlyWithLoader("", source, nil)
+}
+
+// ParseOnlyWithLoader parses the source of the named file and the files it
+// includes without creating an interpreter, returns JSON
+func ParseOnlyWithLoader(file string, source string, loader parser.Loader) string {
 	// Scan tokens
-	scanner := scanner.New(source)
+	scanner := scanner.NewWithFile(source, file)
 	tokens, scannerErrors := scanner.ScanTokens()
 
 	if len(scannerErrors) > 0 {
@@ -286,14 +438,25 @@ func ParseOnly(source string) string {
 			Error:   "Scanner errors occurred",
 		}
 
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
 	// Parse program
-	parser := parser.New(tokens)
+	parser := parser.NewWithLoader(tokens, loader)
 	program, parserErrors := parser.Parse()
 
+	// Scanner errors of included files are only known after parsing
+	if len(parser.ScannerErrors()) > 0 {
+		result := JSONResult{
+			Success: false,
+			Type:    "scanner_errors",
+			Data:    parser.ScannerErrors(),
+			Error:   "Scanner errors occurred",
+		}
+
+		return marshal(result)
+	}
+
 	if len(parserErrors) > 0 {
 		result := JSONResult{
 			Success: false,
@@ -302,14 +465,27 @@ func ParseOnly(source string) string {
 			Error:   "Parser errors occurred",
 		}
 
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes)
+		return marshal(result)
 	}
 
-	// Return success with program info
+	// Check the program, warnings and infos do not fail the parse
+	diagnostics := checker.Check(program)
+
 	programInfo := map[string]interface{}{
 		"statement_count": len(program.Statements),
 		"parsed":          true,
+		"diagnostics":     diagnostics,
+	}
+
+	if checker.HasErrors(diagnostics) {
+		result := JSONResult{
+			Success: false,
+			Type:    "check_errors",
+			Data:    programInfo,
+			Error:   "Check errors occurred",
+		}
+
+		return marshal(result)
 	}
 
 	result := JSONResult{
@@ -318,6 +494,5 @@ func ParseOnly(source string) string {
 		Data:    programInfo,
 	}
 
-	jsonBytes, _ := json.Marshal(result)
-	return string(jsonBytes)
+	return marshal(result)
 }
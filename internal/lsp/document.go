@@ -0,0 +1,435 @@
+package lsp
+
+import (
+	"quill/internal/ast"
+	"quill/internal/checker"
+	"quill/internal/parser"
+	"quill/internal/scanner"
+	"quill/internal/token"
+	"strings"
+)
+
+type nameKind int
+
+const (
+	labelName nameKind = iota
+	sceneName
+	optionName
+	variableName
+	characterName
+	toolName
+)
+
+// occurrence is a name written in a script, such as the label of a GOTO or a
+// variable in an expression. Labels, scenes and options are resolved to their
+// qualified name, so occurrences of the same name compare equal.
+type occurrence struct {
+	kind       nameKind
+	name       string
+	file       string
+	offset     int // byte offset of the name in its file
+	length     int
+	definition bool
+	statement  ast.Statement // the statement the name is defined in, for definitions
+}
+
+// document is an open script and what was learned from analyzing it
+type document struct {
+	uri     string
+	file    string
+	text    string
+	sources map[string]string // file to source, for the document and the files it includes
+
+	program     *ast.Program
+	diagnostics []Diagnostic
+	occurrences []occurrence
+}
+
+func newDocument(uri string, text string) *document {
+	doc := &document{
+		uri:  uri,
+		file: pathOf(uri),
+		text: text,
+	}
+	doc.analyze()
+	return doc
+}
+
+// analyze scans, parses and checks the document. The parser recovers from
+// errors, so names are known even while a line is being typed.
+func (doc *document) analyze() {
+	doc.sources = map[string]string{doc.file: doc.text}
+	loader := func(path string) (string, error) {
+		source, err := parser.FileLoader(path)
+		if err == nil {
+			doc.sources[path] = source
+		}
+		return source, err
+	}
+
+	tokens, scannerErrors := scanner.NewWithFile(doc.text, doc.file).ScanTokens()
+	scriptParser := parser.NewWithLoader(tokens, loader)
+	program, parserErrors := scriptParser.Parse()
+	scannerErrors = append(scannerErrors, scriptParser.ScannerErrors()...)
+	doc.program = program
+
+	doc.diagnostics = []Diagnostic{}
+	for _, err := range scannerErrors {
+		doc.addDiagnostic(err.File, err.Offset, SeverityError, err.Message)
+	}
+	for _, err := range parserErrors {
+		doc.addDiagnostic(err.File, err.Offset, SeverityError, err.Message)
+	}
+
+	// Names of statements that failed to parse are missing, checking would report them as undefined
+	if len(scannerErrors) == 0 && len(parserErrors) == 0 {
+		for _, diagnostic := range checker.Check(program) {
+			doc.addDiagnostic(diagnostic.File, diagnostic.Offset, checkSeverity(diagnostic.Severity), diagnostic.Message)
+		}
+	}
+
+	doc.index()
+}
+
+// addDiagnostic keeps diagnostics of the document itself, included files
+// report theirs when they are open
+func (doc *document) addDiagnostic(file string, offset int, severity DiagnosticSeverity, message string) {
+	if file != doc.file {
+		return
+	}
+	doc.diagnostics = append(doc.diagnostics, Diagnostic{
+		Range:    rangeOf(doc.text, offset, wordLength(doc.text, offset)),
+		Severity: severity,
+		Source:   "quill",
+		Message:  message,
+	})
+}
+
+func checkSeverity(severity checker.Severity) DiagnosticSeverity {
+	switch severity {
+	case checker.SeverityError:
+		return SeverityError
+	case checker.SeverityWarning:
+		return SeverityWarning
+	default:
+		return SeverityInformation
+	}
+}
+
+// index collects the occurrences of all names. Definitions come first, so
+// references can be resolved the way the interpreter resolves them.
+func (doc *document) index() {
+	doc.occurrences = nil
+	doc.declare(doc.program.Statements)
+	doc.reference(doc.program.Statements)
+}
+
+func (doc *document) declare(statements []ast.Statement) {
+	for _, stmt := range statements {
+		switch node := stmt.(type) {
+		case *ast.LabelStatement:
+			doc.addDefinition(labelName, node.Name, stmt)
+		case *ast.SceneStatement:
+			doc.addDefinition(sceneName, node.Name, stmt)
+		case *ast.LetStatement:
+			doc.addDefinition(variableName, node.Name, stmt)
+		case *ast.ForStatement:
+			doc.addDefinition(variableName, node.Variable, stmt)
+		case *ast.ChoiceStatement:
+			for _, option := range node.Options {
+				if option.Name != nil {
+					doc.addDefinition(optionName, option.Name, stmt)
+				}
+			}
+		}
+
+		for _, block := range ast.ChildBlocks(stmt) {
+			if block != nil {
+				doc.declare(block.Statements)
+			}
+		}
+	}
+}
+
+func (doc *document) addDefinition(kind nameKind, name *ast.Identifier, stmt ast.Statement) {
+	qualified := name.Value
+	if kind != variableName {
+		qualified = ast.QualifiedName(name.Token.File, name.Value)
+	}
+	doc.occurrences = append(doc.occurrences, occurrence{
+		kind:       kind,
+		name:       qualified,
+		file:       name.Token.File,
+		offset:     name.Token.Offset,
+		length:     len(name.Token.Lexeme),
+		definition: true,
+		statement:  stmt,
+	})
+}
+
+func (doc *document) addReference(kind nameKind, name string, at token.Token, offset int) {
+	doc.occurrences = append(doc.occurrences, occurrence{
+		kind:   kind,
+		name:   name,
+		file:   at.File,
+		offset: offset,
+		length: len(name),
+	})
+}
+
+// resolve returns the qualified name a label, scene or option name refers
+// to: a name of the file it is used in, or else a name outside of any file
+func (doc *document) resolve(kind nameKind, name *ast.Identifier) string {
+	qualified := ast.QualifiedName(name.Token.File, name.Value)
+	for _, occ := range doc.occurrences {
+		if occ.definition && occ.kind == kind && occ.name == qualified {
+			return qualified
+		}
+	}
+	return name.Value
+}
+
+func (doc *document) referenceName(kind nameKind, name *ast.Identifier) {
+	doc.occurrences = append(doc.occurrences, occurrence{
+		kind:   kind,
+		name:   doc.resolve(kind, name),
+		file:   name.Token.File,
+		offset: name.Token.Offset,
+		length: len(name.Value), // a qualified name spans several tokens
+	})
+}
+
+func (doc *document) reference(statements []ast.Statement) {
+	for _, stmt := range statements {
+		switch node := stmt.(type) {
+		case *ast.GotoStatement:
+			doc.referenceName(labelName, node.Label)
+		case *ast.CallStatement:
+			doc.referenceName(sceneName, node.Scene)
+		case *ast.AssignStatement:
+			doc.addReference(variableName, node.Name.Value, node.Name.Token, node.Name.Token.Offset)
+			doc.expression(node.Value)
+		case *ast.LetStatement:
+			doc.expression(node.Value)
+		case *ast.DialogStatement:
+			doc.addReference(characterName, node.Character.Value, node.Character.Token, node.Character.Token.Offset)
+			doc.expression(node.Text)
+		case *ast.IfStatement:
+			doc.expression(node.Condition)
+			for _, elseIf := range node.ElseIfs {
+				doc.expression(elseIf.Condition)
+			}
+		case *ast.MatchStatement:
+			doc.expression(node.Value)
+			for _, matchCase := range node.Cases {
+				if matchCase.Value != nil {
+					doc.expression(matchCase.Value)
+				}
+			}
+		case *ast.ForStatement:
+			doc.expression(node.Iterable)
+		case *ast.ChoiceStatement:
+			for _, option := range node.Options {
+				doc.expression(option.Text)
+				if option.Condition != nil {
+					doc.expression(option.Condition)
+				}
+			}
+		case *ast.RandomStatement:
+			for _, option := range node.Options {
+				if option.Condition != nil {
+					doc.expression(option.Condition)
+				}
+			}
+		}
+
+		for _, block := range ast.ChildBlocks(stmt) {
+			if block != nil {
+				doc.reference(block.Statements)
+			}
+		}
+	}
+}
+
+func (doc *document) expression(expr ast.Expression) {
+	switch node := expr.(type) {
+	case *ast.Identifier:
+		doc.addReference(variableName, node.Value, node.Token, node.Token.Offset)
+	case *ast.InfixExpression:
+		doc.expression(node.Left)
+		doc.expression(node.Right)
+	case *ast.PrefixExpression:
+		doc.expression(node.Right)
+	case *ast.IndexExpression:
+		doc.expression(node.Left)
+		doc.expression(node.Index)
+	case *ast.ListLiteral:
+		for _, element := range node.Elements {
+			doc.expression(element)
+		}
+	case *ast.MapLiteral:
+		for idx := range node.Keys {
+			doc.expression(node.Keys[idx])
+			doc.expression(node.Values[idx])
+		}
+	case *ast.ToolCall:
+		// The name follows the '<'
+		doc.addReference(toolName, node.Function, node.Token, node.Token.Offset+1)
+		for _, argument := range node.Arguments {
+			doc.expression(argument)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			doc.expression(part)
+		}
+	case *ast.ConditionalText:
+		doc.expression(node.Condition)
+		doc.expression(node.Consequence)
+		if node.Alternative != nil {
+			doc.expression(node.Alternative)
+		}
+	case *ast.AlternativeText:
+		for _, option := range node.Options {
+			doc.expression(option)
+		}
+	case *ast.VisitsExpression:
+		// VISITS reads a label, or a choice option if there is no such label
+		name := doc.resolve(labelName, node.Name)
+		if doc.defined(labelName, name) {
+			doc.referenceName(labelName, node.Name)
+		} else {
+			doc.referenceName(optionName, node.Name)
+		}
+	}
+}
+
+func (doc *document) defined(kind nameKind, name string) bool {
+	for _, occ := range doc.occurrences {
+		if occ.definition && occ.kind == kind && occ.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrenceAt returns the name at an offset of the document
+func (doc *document) occurrenceAt(offset int) (occurrence, bool) {
+	for _, occ := range doc.occurrences {
+		if occ.file == doc.file && offset >= occ.offset && offset <= occ.offset+occ.length {
+			return occ, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// related returns the occurrences of the same name, the definitions first
+func (doc *document) related(target occurrence, includeDefinitions bool) []occurrence {
+	var definitions, references []occurrence
+	for _, occ := range doc.occurrences {
+		if occ.kind != target.kind || occ.name != target.name {
+			continue
+		}
+		if occ.definition {
+			definitions = append(definitions, occ)
+		} else {
+			references = append(references, occ)
+		}
+	}
+
+	if !includeDefinitions {
+		return references
+	}
+	return append(definitions, references...)
+}
+
+func (doc *document) location(occ occurrence) Location {
+	return Location{
+		URI:   uriOf(occ.file),
+		Range: rangeOf(doc.sources[occ.file], occ.offset, occ.length),
+	}
+}
+
+// sourceLine returns the line of a file an occurrence is written on
+func (doc *document) sourceLine(occ occurrence) string {
+	source := doc.sources[occ.file]
+	start := strings.LastIndexByte(source[:occ.offset], '\n') + 1
+	end := strings.IndexByte(source[occ.offset:], '\n')
+	if end < 0 {
+		return strings.TrimSpace(source[start:])
+	}
+	return strings.TrimSpace(source[start : occ.offset+end])
+}
+
+// symbols outlines labels, scenes and choices with their options
+func (doc *document) symbols(statements []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, stmt := range statements {
+		if ast.StatementToken(stmt).File != doc.file {
+			continue
+		}
+
+		switch node := stmt.(type) {
+		case *ast.LabelStatement:
+			symbols = append(symbols, DocumentSymbol{
+				Name:           node.Name.Value,
+				Detail:         "LABEL",
+				Kind:           SymbolNamespace,
+				Range:          doc.span(node.Token, node.Name.Token),
+				SelectionRange: doc.span(node.Name.Token, node.Name.Token),
+			})
+			continue
+
+		case *ast.SceneStatement:
+			symbols = append(symbols, DocumentSymbol{
+				Name:           node.Name.Value,
+				Detail:         "SCENE",
+				Kind:           SymbolFunction,
+				Range:          doc.span(node.Token, node.Body.End),
+				SelectionRange: doc.span(node.Name.Token, node.Name.Token),
+				Children:       doc.symbols(node.Body.Statements),
+			})
+			continue
+
+		case *ast.ChoiceStatement:
+			options := []DocumentSymbol{}
+			for _, option := range node.Options {
+				text := ast.ExpressionToken(option.Text)
+				detail := ""
+				if option.Name != nil {
+					detail = "AS " + option.Name.Value
+				}
+				options = append(options, DocumentSymbol{
+					Name:           text.Lexeme,
+					Detail:         detail,
+					Kind:           SymbolEnumMember,
+					Range:          doc.span(text, option.Body.End),
+					SelectionRange: doc.span(text, text),
+					Children:       doc.symbols(option.Body.Statements),
+				})
+			}
+			symbols = append(symbols, DocumentSymbol{
+				Name:           "CHOICE",
+				Kind:           SymbolEnum,
+				Range:          doc.span(node.Token, node.End),
+				SelectionRange: doc.span(node.Token, node.Token),
+				Children:       options,
+			})
+			continue
+		}
+
+		for _, block := range ast.ChildBlocks(stmt) {
+			if block != nil {
+				symbols = append(symbols, doc.symbols(block.Statements)...)
+			}
+		}
+	}
+	return symbols
+}
+
+// span returns the range from the start of one token to the end of another
+func (doc *document) span(start token.Token, end token.Token) Range {
+	return Range{
+		Start: positionAt(doc.text, start.Offset),
+		End:   positionAt(doc.text, end.Offset+len(end.Lexeme)),
+	}
+}
@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// positionAt converts a byte offset in text to a protocol position
+func positionAt(text string, offset int) Position {
+	offset = min(max(offset, 0), len(text))
+
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	line := strings.Count(text[:lineStart], "\n")
+	return Position{Line: line, Character: utf16Length(text[lineStart:offset])}
+}
+
+// offsetAt converts a protocol position to a byte offset in text
+func offsetAt(text string, position Position) int {
+	offset := 0
+	for line := 0; line < position.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+
+	for character := 0; character < position.Character && offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		character += utf16Width(r)
+		offset += size
+	}
+	return offset
+}
+
+// rangeOf returns the range of length bytes from offset
+func rangeOf(text string, offset int, length int) Range {
+	return Range{Start: positionAt(text, offset), End: positionAt(text, offset+length)}
+}
+
+func utf16Length(text string) int {
+	length := 0
+	for _, r := range text {
+		length += utf16Width(r)
+	}
+	return length
+}
+
+func utf16Width(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// wordLength returns the length of the name at offset, or of the character
+// there if it is not part of a name. A line break has no length.
+func wordLength(text string, offset int) int {
+	if offset >= len(text) || text[offset] == '\n' {
+		return 0
+	}
+
+	length := 0
+	for offset+length < len(text) {
+		r, size := utf8.DecodeRuneInString(text[offset+length:])
+		if !isNameRune(r) {
+			break
+		}
+		length += size
+	}
+	if length == 0 {
+		_, length = utf8.DecodeRuneInString(text[offset:])
+	}
+	return length
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// pathOf returns the file path of a file URI, other URIs are used as they are
+func pathOf(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+// uriOf returns the file URI of a path
+func uriOf(path string) string {
+	if strings.Contains(path, "://") {
+		return path
+	}
+	absolute, err := filepath.Abs(path)
+	if err == nil {
+		path = absolute
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,85 @@
+package lsp
+
+import "testing"
+
+func TestPositions(t *testing.T) {
+	// ü takes two bytes and one UTF-16 unit, 語 three bytes and one unit and
+	// 😀 four bytes and two units
+	text := "LET a = 1\nJÜRGEN: \"Grüß 語 😀 x\"\n\nEND"
+
+	tests := []struct {
+		offset   int
+		position Position
+	}{
+		{0, Position{Line: 0, Character: 0}},
+		{9, Position{Line: 0, Character: 9}},   // end of the first line
+		{10, Position{Line: 1, Character: 0}},  // J
+		{13, Position{Line: 1, Character: 2}},  // R after Ü
+		{24, Position{Line: 1, Character: 12}}, // ß after Grü
+		{27, Position{Line: 1, Character: 14}}, // 語
+		{30, Position{Line: 1, Character: 15}}, // the space after 語
+		{31, Position{Line: 1, Character: 16}}, // 😀
+		{35, Position{Line: 1, Character: 18}}, // the space after 😀
+		{36, Position{Line: 1, Character: 19}}, // x
+		{38, Position{Line: 1, Character: 21}}, // end of the second line
+		{39, Position{Line: 2, Character: 0}},  // the blank line
+		{40, Position{Line: 3, Character: 0}},  // END
+		{43, Position{Line: 3, Character: 3}},  // end of the text
+	}
+
+	for _, test := range tests {
+		if got := positionAt(text, test.offset); got != test.position {
+			t.Errorf("positionAt(%d) = %+v, want %+v", test.offset, got, test.position)
+		}
+		if got := offsetAt(text, test.position); got != test.offset {
+			t.Errorf("offsetAt(%+v) = %d, want %d", test.position, got, test.offset)
+		}
+	}
+}
+
+func TestPositionsOutOfRange(t *testing.T) {
+	text := "Ä: \"😀\"\nEND"
+
+	tests := []struct {
+		position Position
+		offset   int
+	}{
+		{Position{Line: 0, Character: 100}, 10}, // stops at the line break
+		{Position{Line: 5, Character: 0}, 14},   // past the last line
+		{Position{Line: 1, Character: 9}, 14},   // past the end of the text
+	}
+
+	for _, test := range tests {
+		if got := offsetAt(text, test.position); got != test.offset {
+			t.Errorf("offsetAt(%+v) = %d, want %d", test.position, got, test.offset)
+		}
+	}
+
+	if got := positionAt(text, 100); got != (Position{Line: 1, Character: 3}) {
+		t.Errorf("positionAt(100) = %+v, want the end of the text", got)
+	}
+}
+
+func TestWordLength(t *testing.T) {
+	text := "GOTO kapitel1.straße\nŁUKASZ: \"😀\""
+
+	tests := []struct {
+		offset int
+		length int
+	}{
+		{0, 4},   // GOTO
+		{4, 1},   // the space
+		{5, 16},  // kapitel1.straße, ß takes two bytes
+		{21, 0},  // the line break
+		{22, 7},  // ŁUKASZ
+		{29, 1},  // ':'
+		{32, 4},  // 😀
+		{100, 0}, // past the end
+	}
+
+	for _, test := range tests {
+		if got := wordLength(text, test.offset); got != test.length {
+			t.Errorf("wordLength(%d) = %d, want %d", test.offset, got, test.length)
+		}
+	}
+}
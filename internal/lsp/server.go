@@ -0,0 +1,356 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"quill/internal/ast"
+	"quill/internal/interpreter"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Server is a language server for Quill scripts. It reads requests from a
+// client and writes responses and diagnostics back, framed with
+// Content-Length headers as the protocol defines.
+type Server struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client sends exit or closes the connection
+func (s *Server) Run() error {
+	for {
+		body, err := s.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &responseError{Code: parseError, Message: err.Error()})
+			continue
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+		s.handle(req)
+	}
+}
+
+func (s *Server) readMessage() ([]byte, error) {
+	headers, err := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %v", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *Server) write(message any) {
+	body, _ := json.Marshal(message)
+	fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, err *responseError) {
+	if err != nil {
+		s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+		return
+	}
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) handle(req request) {
+	// Notifications have no id and get no response
+	if req.ID == nil {
+		s.handleNotification(req)
+		return
+	}
+
+	if s.shutdown {
+		s.reply(req.ID, nil, &responseError{Code: invalidRequest, Message: "Server is shut down"})
+		return
+	}
+
+	var result any
+	var err error
+	switch req.Method {
+	case "initialize":
+		result = s.initialize()
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/definition":
+		result, err = withParams(req, s.definition)
+	case "textDocument/references":
+		result, err = withParams(req, s.references)
+	case "textDocument/completion":
+		result, err = withParams(req, s.completion)
+	case "textDocument/hover":
+		result, err = withParams(req, s.hover)
+	case "textDocument/documentSymbol":
+		result, err = withParams(req, s.documentSymbols)
+	default:
+		s.reply(req.ID, nil, &responseError{Code: methodNotFound, Message: "Method not found: " + req.Method})
+		return
+	}
+
+	if err != nil {
+		s.reply(req.ID, nil, &responseError{Code: invalidParams, Message: err.Error()})
+		return
+	}
+	s.reply(req.ID, result, nil)
+}
+
+// withParams decodes the parameters of a request and passes them to handler
+func withParams[P any](req request, handler func(P) any) (any, error) {
+	var params P
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, err
+	}
+	return handler(params), nil
+}
+
+func (s *Server) handleNotification(req request) {
+	switch req.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if json.Unmarshal(req.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if json.Unmarshal(req.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			// Changes hold the full text, as requested in initialize
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if json.Unmarshal(req.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	}
+}
+
+// update analyzes a new version of a document and publishes its diagnostics
+func (s *Server) update(uri string, text string) {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics})
+}
+
+func (s *Server) initialize() initializeResult {
+	var result initializeResult
+	result.ServerInfo.Name = "quill"
+	result.Capabilities.TextDocumentSync = 1 // full text on every change
+	result.Capabilities.DefinitionProvider = true
+	result.Capabilities.ReferencesProvider = true
+	result.Capabilities.HoverProvider = true
+	result.Capabilities.DocumentSymbolProvider = true
+	result.Capabilities.CompletionProvider.TriggerCharacters = []string{"<", "("}
+	return result
+}
+
+// lookup returns the document and the name at a position, if there is one
+func (s *Server) lookup(params textDocumentPositionParams) (*document, occurrence, bool) {
+	doc, exists := s.documents[params.TextDocument.URI]
+	if !exists {
+		return nil, occurrence{}, false
+	}
+	occ, found := doc.occurrenceAt(offsetAt(doc.text, params.Position))
+	return doc, occ, found
+}
+
+func (s *Server) definition(params textDocumentPositionParams) any {
+	doc, occ, found := s.lookup(params)
+	if !found {
+		return nil
+	}
+
+	// A variable is defined by its first LET, the rest assign to it
+	for _, related := range doc.related(occ, true) {
+		if related.definition {
+			return doc.location(related)
+		}
+	}
+	return nil
+}
+
+func (s *Server) references(params referenceParams) any {
+	doc, occ, found := s.lookup(params.textDocumentPositionParams)
+	if !found {
+		return []Location{}
+	}
+
+	locations := []Location{}
+	for _, related := range doc.related(occ, params.Context.IncludeDeclaration) {
+		locations = append(locations, doc.location(related))
+	}
+	return locations
+}
+
+func (s *Server) hover(params textDocumentPositionParams) any {
+	doc, occ, found := s.lookup(params)
+	if !found || (occ.kind != variableName && occ.kind != labelName && occ.kind != sceneName) {
+		return nil
+	}
+
+	for _, related := range doc.related(occ, true) {
+		if !related.definition {
+			continue
+		}
+
+		where := "line " + strconv.Itoa(positionAt(doc.sources[related.file], related.offset).Line+1)
+		if related.file != doc.file {
+			where += " of " + related.file
+		}
+		hoverRange := rangeOf(doc.text, occ.offset, occ.length)
+		return Hover{
+			Contents: MarkupContent{
+				Kind:  "markdown",
+				Value: "```quill\n" + doc.sourceLine(related) + "\n```\nDefined at " + where,
+			},
+			Range: &hoverRange,
+		}
+	}
+	return nil
+}
+
+func (s *Server) documentSymbols(params documentSymbolParams) any {
+	doc, exists := s.documents[params.TextDocument.URI]
+	if !exists {
+		return []DocumentSymbol{}
+	}
+	return doc.symbols(doc.program.Statements)
+}
+
+// completion offers the names that fit where the cursor is: labels after
+// GOTO, scenes after CALL, labels and options in VISITS, tools after '<',
+// characters at the start of a line and variables everywhere else
+func (s *Server) completion(params textDocumentPositionParams) any {
+	doc, exists := s.documents[params.TextDocument.URI]
+	if !exists {
+		return []CompletionItem{}
+	}
+
+	offset := offsetAt(doc.text, params.Position)
+	lineStart := strings.LastIndexByte(doc.text[:offset], '\n') + 1
+	before := doc.text[lineStart:offset]
+
+	// Leave out the part of the name that is being typed
+	prefix := strings.TrimRightFunc(before, isNameRune)
+	trimmed := strings.TrimSpace(prefix)
+
+	switch {
+	case strings.HasSuffix(trimmed, "GOTO"):
+		return doc.completions(labelName)
+	case strings.HasSuffix(trimmed, "CALL"):
+		return doc.completions(sceneName)
+	case strings.HasSuffix(trimmed, "VISITS("):
+		return append(doc.completions(labelName), doc.completions(optionName)...)
+	case strings.HasSuffix(prefix, "<"):
+		return doc.toolCompletions()
+	case trimmed == "":
+		return append(doc.completions(characterName), doc.completions(variableName)...)
+	default:
+		return doc.completions(variableName)
+	}
+}
+
+func (doc *document) completions(kind nameKind) []CompletionItem {
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+	for _, occ := range doc.occurrences {
+		// Characters are never defined, every line of dialog names one
+		if occ.kind != kind || (!occ.definition && kind != characterName) {
+			continue
+		}
+
+		name := doc.writtenName(occ)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		detail := "character"
+		if occ.definition {
+			detail = doc.sourceLine(occ)
+		}
+		items = append(items, CompletionItem{Label: name, Kind: completionKinds[kind], Detail: detail})
+	}
+	return items
+}
+
+var completionKinds = map[nameKind]CompletionItemKind{
+	labelName:     CompletionReference,
+	sceneName:     CompletionModule,
+	optionName:    CompletionEnumMember,
+	variableName:  CompletionVariable,
+	characterName: CompletionConstant,
+	toolName:      CompletionFunction,
+}
+
+// writtenName returns a name the way it is written in the document: names of
+// the document's own file without its namespace
+func (doc *document) writtenName(occ occurrence) string {
+	if occ.kind == variableName || occ.kind == characterName || occ.kind == toolName {
+		return occ.name
+	}
+	if occ.file == doc.file {
+		return strings.TrimPrefix(occ.name, ast.Namespace(doc.file)+".")
+	}
+	return occ.name
+}
+
+// toolCompletions offers the built-in functions and the tools the document
+// already calls
+func (doc *document) toolCompletions() []CompletionItem {
+	names := make(map[string]string)
+	for _, occ := range doc.occurrences {
+		if occ.kind == toolName {
+			names[occ.name] = "tool"
+		}
+	}
+	for _, name := range interpreter.BuiltinNames() {
+		names[name] = "built-in function"
+	}
+
+	items := make([]CompletionItem, 0, len(names))
+	for name, detail := range names {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: detail})
+	}
+	sort.Slice(items, func(a, b int) bool {
+		return items[a].Label < items[b].Label
+	})
+	return items
+}
@@ -0,0 +1,182 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+// session sends requests and notifications to a server, framed as a client
+// does, and returns the messages the server wrote back
+func session(t *testing.T, requests ...map[string]any) []message {
+	t.Helper()
+
+	var in bytes.Buffer
+	for _, req := range requests {
+		req["jsonrpc"] = "2.0"
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server reads the framing it writes
+	reader := NewServer(&out, io.Discard)
+	var messages []message
+	for {
+		body, err := reader.readMessage()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, msg)
+	}
+}
+
+func diagnosticsOf(t *testing.T, msg message) publishDiagnosticsParams {
+	t.Helper()
+
+	if msg.Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("got %s, want diagnostics", msg.Method)
+	}
+	var params publishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestDiagnosticsRoundTrip(t *testing.T) {
+	uri := "file:///story/main.q"
+	messages := session(t,
+		map[string]any{"id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri, "text": "ÄNNE: \"Grüß 😀\"\nGOTO nowhere\n"},
+		}},
+		map[string]any{"method": "textDocument/didChange", "params": map[string]any{
+			"textDocument":   map[string]any{"uri": uri},
+			"contentChanges": []map[string]any{{"text": "ÄNNE: \"Grüß 😀\"\nGOTO nowhere\nLABEL nowhere\nEND\n"}},
+		}},
+		map[string]any{"method": "textDocument/didClose", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+		}},
+		map[string]any{"id": 2, "method": "shutdown"},
+		map[string]any{"method": "exit"},
+	)
+
+	if len(messages) != 5 {
+		t.Fatalf("got %d messages, want 5", len(messages))
+	}
+	if messages[0].ID == nil || *messages[0].ID != 1 || !strings.Contains(string(messages[0].Result), `"capabilities"`) {
+		t.Errorf("got %+v, want the initialize result", messages[0])
+	}
+
+	opened := diagnosticsOf(t, messages[1])
+	want := Range{Start: Position{Line: 1, Character: 5}, End: Position{Line: 1, Character: 12}}
+	if opened.URI != uri || len(opened.Diagnostics) != 1 || opened.Diagnostics[0].Range != want || opened.Diagnostics[0].Severity != SeverityError {
+		t.Fatalf("got %+v, want an error at %+v", opened, want)
+	}
+	if !strings.Contains(opened.Diagnostics[0].Message, "nowhere") {
+		t.Errorf("got message %q, want one about the label", opened.Diagnostics[0].Message)
+	}
+
+	for idx, step := range []string{"change", "close"} {
+		if cleared := diagnosticsOf(t, messages[idx+2]); cleared.URI != uri || len(cleared.Diagnostics) != 0 {
+			t.Errorf("got %+v after the %s, want no diagnostics", cleared, step)
+		}
+	}
+
+	if messages[4].ID == nil || *messages[4].ID != 2 {
+		t.Errorf("got %+v, want the shutdown response", messages[4])
+	}
+}
+
+func TestDefinitionAcrossNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	chapter := filepath.Join(dir, "chapter1.q")
+	if err := os.WriteFile(chapter, []byte("# Chapter one\nLABEL straße\nÜLI: \"Hallo\"\nEND\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := uriOf(filepath.Join(dir, "main.q"))
+	messages := session(t,
+		map[string]any{"method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri, "text": "INCLUDE \"chapter1.q\"\nCHOICE { \"😀\" { GOTO chapter1.straße } }\n"},
+		}},
+		map[string]any{"id": 1, "method": "textDocument/definition", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": 1, "character": 30}, // the ß of straße, after two UTF-16 units for 😀
+		}},
+		map[string]any{"method": "exit"},
+	)
+
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+	if opened := diagnosticsOf(t, messages[0]); len(opened.Diagnostics) != 0 {
+		t.Errorf("got diagnostics %+v, want none", opened.Diagnostics)
+	}
+
+	var location Location
+	if err := json.Unmarshal(messages[1].Result, &location); err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		URI:   uriOf(chapter),
+		Range: Range{Start: Position{Line: 1, Character: 6}, End: Position{Line: 1, Character: 12}},
+	}
+	if location != want {
+		t.Errorf("got %+v, want %+v", location, want)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		input string
+		body  string // empty when reading fails
+	}{
+		{"Content-Length: 2\r\n\r\n{}", "{}"},
+		{"Content-Length: 8\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n\"Grüß\"", "\"Grüß\""},
+		{"content-length: 2\r\n\r\n[]", "[]"},
+		{"Content-Type: text/plain\r\n\r\n{}", ""},
+		{"Content-Length: ten\r\n\r\n{}", ""},
+		{"Content-Length: 10\r\n\r\n{}", ""},
+	}
+
+	for _, test := range tests {
+		body, err := NewServer(strings.NewReader(test.input), io.Discard).readMessage()
+		if test.body == "" {
+			if err == nil {
+				t.Errorf("%q: got %q, want an error", test.input, body)
+			}
+			continue
+		}
+		if err != nil || string(body) != test.body {
+			t.Errorf("%q: got %q and error %v, want %q", test.input, body, err, test.body)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"quill/internal/ast"
+	"quill/internal/scanner"
+	"quill/internal/token"
+	"slices"
+	"strings"
+)
+
+// Loader returns the source of an included file. The path is the one written
+// in the INCLUDE statement, joined to the directory of the including file.
+type Loader func(path string) (string, error)
+
+// FileLoader reads included files from disk
+func FileLoader(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// MapLoader serves included files from memory, keyed by path
+func MapLoader(files map[string]string) Loader {
+	return func(path string) (string, error) {
+		source, exists := files[path]
+		if !exists {
+			return "", fmt.Errorf("file not found: %s", path)
+		}
+		return source, nil
+	}
+}
+
+// NewWithLoader creates a parser that resolves INCLUDE statements with loader
+func NewWithLoader(tokens []token.Token, loader Loader) *Parser {
+	parser := New(tokens)
+	parser.loader = loader
+	return parser
+}
+
+func (p *Parser) parseIncludeStatement() (ast.Statement, *ParseError) {
+	includeToken := p.peek()
+	p.advance() // consume INCLUDE
+
+	if !p.check(token.STRING) {
+		return nil, p.expected("file path after INCLUDE")
+	}
+
+	pathLiteral := &ast.StringLiteral{
+		Token: p.peek(),
+		Value: unescapeString(p.peek().Literal.(string)),
+	}
+	p.advance() // consume path
+
+	if p.loader == nil {
+		return nil, &ParseError{
+			Line:    includeToken.Line,
+			Column:  includeToken.Column,
+			Offset:  includeToken.Offset,
+			Message: "INCLUDE is not available without a file loader",
+		}
+	}
+
+	file := path.Join(path.Dir(strings.ReplaceAll(p.file, `\`, "/")), pathLiteral.Value)
+	if slices.Contains(p.including, file) {
+		return nil, &ParseError{
+			Line:    includeToken.Line,
+			Column:  includeToken.Column,
+			Offset:  includeToken.Offset,
+			Message: "File '" + file + "' includes itself: " + strings.Join(slices.Concat(p.including[slices.Index(p.including, file):], []string{file}), " > "),
+		}
+	}
+
+	// A file included by several others, such as shared scenes, is only
+	// included the first time
+	if p.included[file] {
+		return &ast.IncludeStatement{
+			Token: includeToken,
+			Path:  pathLiteral,
+			File:  file,
+			Body:  &ast.BlockStatement{Token: includeToken},
+		}, nil
+	}
+
+	namespace := ast.Namespace(file)
+	if owner, exists := p.namespaces[namespace]; exists {
+		return nil, &ParseError{
+			Line:    includeToken.Line,
+			Column:  includeToken.Column,
+			Offset:  includeToken.Offset,
+			Message: "File '" + file + "' has the same namespace as '" + owner + "'",
+		}
+	}
+
+	source, err := p.loader(file)
+	if err != nil {
+		return nil, &ParseError{
+			Line:    includeToken.Line,
+			Column:  includeToken.Column,
+			Offset:  includeToken.Offset,
+			Message: "Cannot include '" + file + "': " + err.Error(),
+		}
+	}
+
+	p.included[file] = true
+	p.namespaces[namespace] = file
+
+	tokens, scannerErrors := scanner.NewWithFile(source, file).ScanTokens()
+	p.scanErrors = append(p.scanErrors, scannerErrors...)
+
+	child := NewWithLoader(tokens, p.loader)
+	child.included = p.included
+	child.namespaces = p.namespaces
+	child.including = append(slices.Clone(p.including), file)
+
+	program, parseErrors := child.Parse()
+	p.errors = append(p.errors, parseErrors...)
+	p.scanErrors = append(p.scanErrors, child.scanErrors...)
+
+	return &ast.IncludeStatement{
+		Token: includeToken,
+		Path:  pathLiteral,
+		File:  file,
+		Body: &ast.BlockStatement{
+			Token:      includeToken,
+			Statements: program.Statements,
+		},
+	}, nil
+}
+
+// ScannerErrors returns the scanner errors of the files included by the
+// program, with the name of the file they are in. Call it after Parse.
+func (p *Parser) ScannerErrors() []scanner.ScannerError {
+	return p.scanErrors
+}
+
+// parseQualifiedIdentifier parses a name that may be prefixed with the
+// namespace of another file, such as chapter1.start
+func (p *Parser) parseQualifiedIdentifier() *ast.Identifier {
+	identifier := &ast.Identifier{
+		Token: p.peek(),
+		Value: p.peek().Lexeme,
+	}
+	p.advance() // consume identifier
+
+	if p.check(token.DOT) && p.checkNext(token.IDENT) {
+		p.advance() // consume '.'
+		identifier.Value += "." + p.peek().Lexeme
+		p.advance() // consume identifier
+	}
+
+	return identifier
+}
@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"quill/internal/scanner"
+	"strings"
+	"testing"
+)
+
+func parseFile(t *testing.T, file string, files map[string]string) (*Parser, []ParseError) {
+	t.Helper()
+
+	tokens, scannerErrors := scanner.NewWithFile(files[strings.TrimPrefix(file, "./")], file).ScanTokens()
+	if len(scannerErrors) > 0 {
+		t.Fatalf("scanner errors: %v", scannerErrors)
+	}
+	parser := NewWithLoader(tokens, MapLoader(files))
+	_, errors := parser.Parse()
+	return parser, errors
+}
+
+func TestIncludedScannerErrorsKeepTheirFile(t *testing.T) {
+	parser, parseErrors := parseFile(t, "a.q", map[string]string{
+		"a.q": "INCLUDE \"b.q\"\nEND\n",
+		"b.q": "LABEL x\nB: \"oops\n",
+	})
+
+	errors := parser.ScannerErrors()
+	if len(errors) != 1 || errors[0].File != "b.q" || errors[0].Line != 2 {
+		t.Errorf("got scanner errors %v, want one at line 2 of b.q", errors)
+	}
+	if len(parseErrors) > 0 {
+		t.Errorf("got parse errors %v, want none", parseErrors)
+	}
+}
+
+func TestIncludeCycleThroughDotPath(t *testing.T) {
+	_, errors := parseFile(t, "./a.q", map[string]string{
+		"a.q": "INCLUDE \"a.q\"\nEND\n",
+	})
+
+	if len(errors) != 1 || !strings.Contains(errors[0].Message, "includes itself") {
+		t.Errorf("got parse errors %v, want the include cycle", errors)
+	}
+}
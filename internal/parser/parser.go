@@ -1,31 +1,60 @@
 package parser
 
 import (
+	"path"
 	"quill/internal/ast"
+	"quill/internal/scanner"
 	"quill/internal/token"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Parser struct {
-	tokens  []token.Token
-	current int
+	tokens     []token.Token
+	current    int
+	file       string
+	loader     Loader
+	included   map[string]bool        // files included so far, shared with included parsers
+	including  []string               // the main file and the files whose INCLUDE leads to this one
+	namespaces map[string]string      // namespace to file, shared with included parsers
+	errors     []ParseError           // errors reported so far, including those of included files
+	scanErrors []scanner.ScannerError // scanner errors of included files
+	tagsFollow bool                   // a '[' at this level starts a tag list instead of an index
 }
 
 type ParseError struct {
+	File    string `json:"file,omitempty"`
 	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Offset  int    `json:"offset"`
 	Message string `json:"message"`
 }
 
 func New(tokens []token.Token) *Parser {
+	file := ""
+	if len(tokens) > 0 {
+		file = tokens[0].File
+	}
+
+	// ./a.q and a.q are the same file when looking for repeated includes
+	seen := file
+	if seen != "" {
+		seen = path.Clean(strings.ReplaceAll(seen, `\`, "/"))
+	}
+
 	return &Parser{
-		tokens:  tokens,
-		current: 0,
+		tokens:     tokens,
+		current:    0,
+		file:       file,
+		included:   map[string]bool{seen: true},
+		including:  []string{seen},
+		namespaces: map[string]string{ast.Namespace(file): file},
 	}
 }
 
 func (p *Parser) Parse() (*ast.Program, []ParseError) {
-	var errors []ParseError = make([]ParseError, 0)
-
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
@@ -37,9 +66,14 @@ func (p *Parser) Parse() (*ast.Program, []ParseError) {
 
 		stmt, err := p.parseStatement()
 		if err != nil {
-			errors = append(errors, *err)
-			// Skip to next statement after error
+			p.report(err)
+
+			// Skip to next statement after error, a '}' without a block is skipped on its own
+			start := p.current
 			p.synchronize()
+			if p.current == start {
+				p.advance()
+			}
 			continue
 		}
 		if stmt != nil {
@@ -47,6 +81,8 @@ func (p *Parser) Parse() (*ast.Program, []ParseError) {
 		}
 	}
 
+	errors := make([]ParseError, 0, len(p.errors))
+	errors = append(errors, p.errors...)
 	return program, errors
 }
 
@@ -56,6 +92,10 @@ func (p *Parser) parseStatement() (ast.Statement, *ParseError) {
 		return p.parseLetStatement()
 	case p.check(token.IF):
 		return p.parseIfStatement()
+	case p.check(token.MATCH):
+		return p.parseMatchStatement()
+	case p.check(token.FOR):
+		return p.parseForStatement()
 	case p.check(token.LABEL):
 		return p.parseLabelStatement()
 	case p.check(token.GOTO):
@@ -64,23 +104,29 @@ func (p *Parser) parseStatement() (ast.Statement, *ParseError) {
 		return p.parseChoiceStatement()
 	case p.check(token.RANDOM):
 		return p.parseRandomStatement()
+	case p.check(token.CYCLE), p.check(token.STOPPING), p.check(token.SHUFFLE), p.check(token.ONCE):
+		return p.parseSequenceStatement()
 	case p.check(token.END):
 		return p.parseEndStatement()
+	case p.check(token.SCENE):
+		return p.parseSceneStatement()
+	case p.check(token.CALL):
+		return p.parseCallStatement()
+	case p.check(token.RETURN):
+		return p.parseReturnStatement()
+	case p.check(token.INCLUDE):
+		return p.parseIncludeStatement()
 	case p.check(token.IDENT):
-		if p.checkNext(token.COLON) {
+		// A name followed by text is dialog with a missing ':', parseDialogStatement reports it
+		if p.checkNext(token.COLON) || p.checkNext(token.STRING) {
 			return p.parseDialogStatement()
 		} else if p.checkNext(token.ASSIGN) || p.checkNext(token.PLUS_ASSIGN) || p.checkNext(token.MINUS_ASSIGN) {
 			return p.parseAssignStatement()
 		}
 	}
 
-	// Unknown token error
-	current := p.peek()
-	p.advance() // Skip unrecognized token
-	return nil, &ParseError{
-		Line:    current.Line,
-		Message: "Unexpected token: " + current.Lexeme,
-	}
+	// Unknown token error, synchronize skips it
+	return nil, p.expected("a statement")
 }
 
 func (p *Parser) parseLetStatement() (ast.Statement, *ParseError) {
@@ -88,10 +134,7 @@ func (p *Parser) parseLetStatement() (ast.Statement, *ParseError) {
 	p.advance() // consume LET
 
 	if !p.check(token.IDENT) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected identifier after LET",
-		}
+		return nil, p.expected("identifier after LET")
 	}
 
 	name := &ast.Identifier{
@@ -101,10 +144,7 @@ func (p *Parser) parseLetStatement() (ast.Statement, *ParseError) {
 	p.advance() // consume identifier
 
 	if !p.check(token.ASSIGN) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '=' after variable name",
-		}
+		return nil, p.expected("'=' after variable name")
 	}
 
 	p.advance() // consume '='
@@ -130,10 +170,7 @@ func (p *Parser) parseAssignStatement() (ast.Statement, *ParseError) {
 
 	operator := p.peek()
 	if !p.check(token.ASSIGN) && !p.check(token.PLUS_ASSIGN) && !p.check(token.MINUS_ASSIGN) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected assignment operator",
-		}
+		return nil, p.expected("assignment operator")
 	}
 	p.advance() // consume operator
 
@@ -159,10 +196,7 @@ func (p *Parser) parseIfStatement() (ast.Statement, *ParseError) {
 	}
 
 	if !p.check(token.LBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '{' after IF condition",
-		}
+		return nil, p.expected("'{' after IF condition")
 	}
 
 	consequence, err := p.parseBlockStatement()
@@ -170,15 +204,39 @@ func (p *Parser) parseIfStatement() (ast.Statement, *ParseError) {
 		return nil, err
 	}
 
+	var elseIfs []*ast.ElseIfClause
+	for p.check(token.ELSE) && p.checkNext(token.IF) {
+		p.advance() // consume ELSE
+		elseIfToken := p.peek()
+		p.advance() // consume IF
+
+		elseIfCondition, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.check(token.LBRACE) {
+			return nil, p.expected("'{' after ELSE IF condition")
+		}
+
+		elseIfConsequence, err := p.parseBlockStatement()
+		if err != nil {
+			return nil, err
+		}
+
+		elseIfs = append(elseIfs, &ast.ElseIfClause{
+			Token:       elseIfToken,
+			Condition:   elseIfCondition,
+			Consequence: elseIfConsequence,
+		})
+	}
+
 	var alternative *ast.BlockStatement
 	if p.check(token.ELSE) {
 		p.advance() // consume ELSE
 
 		if !p.check(token.LBRACE) {
-			return nil, &ParseError{
-				Line:    p.peek().Line,
-				Message: "Expected '{' after ELSE",
-			}
+			return nil, p.expected("'{' after ELSE")
 		}
 
 		alternative, err = p.parseBlockStatement()
@@ -191,19 +249,152 @@ func (p *Parser) parseIfStatement() (ast.Statement, *ParseError) {
 		Token:       ifToken,
 		Condition:   condition,
 		Consequence: consequence,
+		ElseIfs:     elseIfs,
 		Alternative: alternative,
 	}, nil
 }
 
+func (p *Parser) parseForStatement() (ast.Statement, *ParseError) {
+	forToken := p.peek()
+	p.advance() // consume FOR
+
+	if !p.check(token.IDENT) {
+		return nil, p.expected("variable name after FOR")
+	}
+
+	variable := &ast.Identifier{
+		Token: p.peek(),
+		Value: p.peek().Lexeme,
+	}
+	p.advance() // consume variable name
+
+	if !p.check(token.IN) {
+		return nil, p.expected("IN after FOR variable")
+	}
+	p.advance() // consume IN
+
+	iterable, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.check(token.LBRACE) {
+		return nil, p.expected("'{' after FOR list")
+	}
+
+	body, err := p.parseBlockStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.ForStatement{
+		Token:    forToken,
+		Variable: variable,
+		Iterable: iterable,
+		Body:     body,
+	}, nil
+}
+
+func (p *Parser) parseMatchStatement() (ast.Statement, *ParseError) {
+	matchToken := p.peek()
+	p.advance() // consume MATCH
+
+	value, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.check(token.LBRACE) {
+		return nil, p.expected("'{' after MATCH value")
+	}
+
+	p.advance() // consume '{'
+
+	var cases []*ast.MatchCase
+	hasWildcard := false
+
+	for !p.check(token.RBRACE) && !p.isAtEnd() {
+		if p.check(token.NEWLINE) || p.check(token.COMMENT) {
+			p.advance()
+			continue
+		}
+
+		if hasWildcard {
+			p.report(&ParseError{
+				Line:    p.peek().Line,
+				Column:  p.peek().Column,
+				Offset:  p.peek().Offset,
+				Message: "The wildcard case '_' must be the last case of a MATCH",
+			})
+			p.synchronizeOption()
+			continue
+		}
+
+		matchCase, err := p.parseMatchCase()
+		if err != nil {
+			p.report(err)
+			p.synchronizeOption()
+			continue
+		}
+		cases = append(cases, matchCase)
+		hasWildcard = matchCase.Value == nil
+
+		// Consume optional comma
+		if p.check(token.COMMA) {
+			p.advance()
+		}
+	}
+
+	if !p.check(token.RBRACE) {
+		return nil, p.expected("'}' to close MATCH block")
+	}
+
+	end := p.advance() // consume '}'
+
+	return &ast.MatchStatement{
+		Token: matchToken,
+		Value: value,
+		Cases: cases,
+		End:   end,
+	}, nil
+}
+
+func (p *Parser) parseMatchCase() (*ast.MatchCase, *ParseError) {
+	caseToken := p.peek()
+
+	var value ast.Expression
+	if p.check(token.IDENT) && p.peek().Lexeme == "_" {
+		p.advance() // consume '_'
+	} else {
+		var err *ParseError
+		value, err = p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.check(token.LBRACE) {
+		return nil, p.expected("'{' after MATCH case")
+	}
+
+	body, err := p.parseBlockStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.MatchCase{
+		Token: caseToken,
+		Value: value,
+		Body:  body,
+	}, nil
+}
+
 func (p *Parser) parseLabelStatement() (ast.Statement, *ParseError) {
 	labelToken := p.peek()
 	p.advance() // consume LABEL
 
 	if !p.check(token.IDENT) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected identifier after LABEL",
-		}
+		return nil, p.expected("identifier after LABEL")
 	}
 
 	name := &ast.Identifier{
@@ -223,17 +414,10 @@ func (p *Parser) parseGotoStatement() (ast.Statement, *ParseError) {
 	p.advance() // consume GOTO
 
 	if !p.check(token.IDENT) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected identifier after GOTO",
-		}
+		return nil, p.expected("identifier after GOTO")
 	}
 
-	label := &ast.Identifier{
-		Token: p.peek(),
-		Value: p.peek().Lexeme,
-	}
-	p.advance() // consume identifier
+	label := p.parseQualifiedIdentifier()
 
 	return &ast.GotoStatement{
 		Token: gotoToken,
@@ -250,6 +434,61 @@ func (p *Parser) parseEndStatement() (ast.Statement, *ParseError) {
 	}, nil
 }
 
+func (p *Parser) parseSceneStatement() (ast.Statement, *ParseError) {
+	sceneToken := p.peek()
+	p.advance() // consume SCENE
+
+	if !p.check(token.IDENT) {
+		return nil, p.expected("identifier after SCENE")
+	}
+
+	name := &ast.Identifier{
+		Token: p.peek(),
+		Value: p.peek().Lexeme,
+	}
+	p.advance() // consume identifier
+
+	if !p.check(token.LBRACE) {
+		return nil, p.expected("'{' after scene name")
+	}
+
+	body, err := p.parseBlockStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.SceneStatement{
+		Token: sceneToken,
+		Name:  name,
+		Body:  body,
+	}, nil
+}
+
+func (p *Parser) parseCallStatement() (ast.Statement, *ParseError) {
+	callToken := p.peek()
+	p.advance() // consume CALL
+
+	if !p.check(token.IDENT) {
+		return nil, p.expected("identifier after CALL")
+	}
+
+	scene := p.parseQualifiedIdentifier()
+
+	return &ast.CallStatement{
+		Token: callToken,
+		Scene: scene,
+	}, nil
+}
+
+func (p *Parser) parseReturnStatement() (ast.Statement, *ParseError) {
+	returnToken := p.peek()
+	p.advance() // consume RETURN
+
+	return &ast.ReturnStatement{
+		Token: returnToken,
+	}, nil
+}
+
 func (p *Parser) parseDialogStatement() (ast.Statement, *ParseError) {
 	character := &ast.Identifier{
 		Token: p.peek(),
@@ -259,15 +498,14 @@ func (p *Parser) parseDialogStatement() (ast.Statement, *ParseError) {
 
 	colonToken := p.peek()
 	if !p.check(token.COLON) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected ':' after character name",
-		}
+		return nil, p.expected("':' after character name")
 	}
 	p.advance() // consume ':'
 
 	// Parse the text as an expression (could be string literal or interpolated string)
+	p.tagsFollow = true
 	text, err := p.parseExpression()
+	p.tagsFollow = false
 	if err != nil {
 		return nil, err
 	}
@@ -298,10 +536,7 @@ func (p *Parser) parseTagList() (*ast.TagList, *ParseError) {
 
 	for !p.check(token.RBRACKET) && !p.isAtEnd() {
 		if !p.check(token.IDENT) {
-			return nil, &ParseError{
-				Line:    p.peek().Line,
-				Message: "Expected identifier in tag list",
-			}
+			return nil, p.expected("identifier in tag list")
 		}
 
 		tag := &ast.Identifier{
@@ -315,18 +550,12 @@ func (p *Parser) parseTagList() (*ast.TagList, *ParseError) {
 		if p.check(token.COMMA) {
 			p.advance()
 		} else if !p.check(token.RBRACKET) {
-			return nil, &ParseError{
-				Line:    p.peek().Line,
-				Message: "Expected ',' or ']' in tag list",
-			}
+			return nil, p.expected("',' or ']' in tag list")
 		}
 	}
 
 	if !p.check(token.RBRACKET) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected ']' to close tag list",
-		}
+		return nil, p.expected("']' to close tag list")
 	}
 
 	p.advance() // consume ']'
@@ -342,10 +571,7 @@ func (p *Parser) parseChoiceStatement() (ast.Statement, *ParseError) {
 	p.advance() // consume CHOICE
 
 	if !p.check(token.LBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '{' after CHOICE",
-		}
+		return nil, p.expected("'{' after CHOICE")
 	}
 
 	p.advance() // consume '{'
@@ -353,14 +579,16 @@ func (p *Parser) parseChoiceStatement() (ast.Statement, *ParseError) {
 	var options []*ast.ChoiceOption
 
 	for !p.check(token.RBRACE) && !p.isAtEnd() {
-		if p.check(token.NEWLINE) {
+		if p.check(token.NEWLINE) || p.check(token.COMMENT) {
 			p.advance()
 			continue
 		}
 
 		option, err := p.parseChoiceOption()
 		if err != nil {
-			return nil, err
+			p.report(err)
+			p.synchronizeOption()
+			continue
 		}
 		if option != nil {
 			options = append(options, option)
@@ -373,39 +601,63 @@ func (p *Parser) parseChoiceStatement() (ast.Statement, *ParseError) {
 	}
 
 	if !p.check(token.RBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '}' to close CHOICE block",
-		}
+		return nil, p.expected("'}' to close CHOICE block")
 	}
 
-	p.advance() // consume '}'
+	end := p.advance() // consume '}'
 
 	return &ast.ChoiceStatement{
 		Token:   choiceToken,
 		Options: options,
+		End:     end,
 	}, nil
 }
 
 func (p *Parser) parseChoiceOption() (*ast.ChoiceOption, *ParseError) {
+	once := false
+	if p.check(token.ONCE) {
+		p.advance() // consume ONCE
+		once = true
+	}
+
 	if !p.check(token.STRING) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected string literal for choice option",
+		return nil, p.expected("string literal for choice option")
+	}
+
+	text, err := p.parseStringLiteral()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse optional name
+	var name *ast.Identifier
+	if p.check(token.AS) {
+		p.advance() // consume AS
+
+		if !p.check(token.IDENT) {
+			return nil, p.expected("option name after AS")
 		}
+		name = &ast.Identifier{
+			Token: p.peek(),
+			Value: p.peek().Lexeme,
+		}
+		p.advance() // consume name
 	}
 
-	text := &ast.StringLiteral{
-		Token: p.peek(),
-		Value: p.peek().Literal.(string),
+	// Parse optional condition
+	var condition ast.Expression
+	if p.check(token.IF) {
+		p.advance() // consume IF
+
+		var err *ParseError
+		condition, err = p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
 	}
-	p.advance()
 
 	if !p.check(token.LBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '{' after choice option text",
-		}
+		return nil, p.expected("'{' after choice option text")
 	}
 
 	body, err := p.parseBlockStatement()
@@ -423,9 +675,12 @@ func (p *Parser) parseChoiceOption() (*ast.ChoiceOption, *ParseError) {
 	}
 
 	return &ast.ChoiceOption{
-		Text: text,
-		Body: body,
-		Tags: tags,
+		Once:      once,
+		Text:      text,
+		Name:      name,
+		Condition: condition,
+		Body:      body,
+		Tags:      tags,
 	}, nil
 }
 
@@ -444,7 +699,9 @@ func (p *Parser) parseBlockStatement() (*ast.BlockStatement, *ParseError) {
 
 		stmt, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.report(err)
+			p.synchronize()
+			continue
 		}
 		if stmt != nil {
 			statements = append(statements, stmt)
@@ -452,16 +709,14 @@ func (p *Parser) parseBlockStatement() (*ast.BlockStatement, *ParseError) {
 	}
 
 	if !p.check(token.RBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '}' to close block",
-		}
+		return nil, p.expected("'}' to close block")
 	}
 
-	p.advance() // consume '}'
+	end := p.advance() // consume '}'
 	return &ast.BlockStatement{
 		Token:      lbraceToken,
 		Statements: statements,
+		End:        end,
 	}, nil
 }
 
@@ -470,10 +725,7 @@ func (p *Parser) parseRandomStatement() (ast.Statement, *ParseError) {
 	p.advance() // consume RANDOM
 
 	if !p.check(token.LBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '{' after RANDOM",
-		}
+		return nil, p.expected("'{' after RANDOM")
 	}
 
 	p.advance() // consume '{'
@@ -481,14 +733,16 @@ func (p *Parser) parseRandomStatement() (ast.Statement, *ParseError) {
 	var options []*ast.RandomOption
 
 	for !p.check(token.RBRACE) && !p.isAtEnd() {
-		if p.check(token.NEWLINE) {
+		if p.check(token.NEWLINE) || p.check(token.COMMENT) {
 			p.advance()
 			continue
 		}
 
 		option, err := p.parseRandomOption()
 		if err != nil {
-			return nil, err
+			p.report(err)
+			p.synchronizeOption()
+			continue
 		}
 		if option != nil {
 			options = append(options, option)
@@ -501,62 +755,152 @@ func (p *Parser) parseRandomStatement() (ast.Statement, *ParseError) {
 	}
 
 	if !p.check(token.RBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '}' to close RANDOM block",
-		}
+		return nil, p.expected("'}' to close RANDOM block")
 	}
 
-	p.advance() // consume '}'
+	end := p.advance() // consume '}'
 
 	return &ast.RandomStatement{
 		Token:   randomToken,
 		Options: options,
+		End:     end,
 	}, nil
 }
 
-func (p *Parser) parseRandomOption() (*ast.RandomOption, *ParseError) {
+func (p *Parser) parseSequenceStatement() (ast.Statement, *ParseError) {
+	sequenceToken := p.peek()
+	p.advance() // consume CYCLE, STOPPING, SHUFFLE or ONCE
+
 	if !p.check(token.LBRACE) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected '{' for random option",
-		}
+		return nil, p.expected("'{' after " + sequenceToken.Lexeme)
 	}
 
-	body, err := p.parseBlockStatement()
-	if err != nil {
-		return nil, err
-	}
+	p.advance() // consume '{'
 
-	// Parse optional tags after the body
-	var tags *ast.TagList
-	if p.check(token.LBRACKET) {
-		tags, err = p.parseTagList()
-		if err != nil {
-			return nil, err
+	var options []*ast.BlockStatement
+
+	for !p.check(token.RBRACE) && !p.isAtEnd() {
+		if p.check(token.NEWLINE) || p.check(token.COMMENT) {
+			p.advance()
+			continue
 		}
-	}
 
-	return &ast.RandomOption{
-		Body: body,
-		Tags: tags,
-	}, nil
-}
+		if !p.check(token.LBRACE) {
+			p.report(p.expected("'{' for " + sequenceToken.Lexeme + " option"))
+			p.synchronizeOption()
+			continue
+		}
+
+		option, err := p.parseBlockStatement()
+		if err != nil {
+			p.report(err)
+			p.synchronizeOption()
+			continue
+		}
+		options = append(options, option)
+
+		// Consume optional comma
+		if p.check(token.COMMA) {
+			p.advance()
+		}
+	}
+
+	if !p.check(token.RBRACE) {
+		return nil, p.expected("'}' to close " + sequenceToken.Lexeme + " block")
+	}
+
+	end := p.advance() // consume '}'
+
+	if len(options) == 0 {
+		return nil, &ParseError{
+			Line:    sequenceToken.Line,
+			Column:  sequenceToken.Column,
+			Offset:  sequenceToken.Offset,
+			Message: sequenceToken.Lexeme + " block has no options",
+		}
+	}
+
+	return &ast.SequenceStatement{
+		Token:   sequenceToken,
+		Options: options,
+		End:     end,
+	}, nil
+}
+
+func (p *Parser) parseRandomOption() (*ast.RandomOption, *ParseError) {
+	// Parse optional weight
+	var weight *ast.IntegerLiteral
+	if p.check(token.INT) {
+		literal, err := p.parseIntegerLiteral()
+		if err != nil {
+			return nil, err
+		}
+		weight = literal.(*ast.IntegerLiteral)
+
+		if weight.Value <= 0 {
+			return nil, &ParseError{
+				Line:    weight.Token.Line,
+				Column:  weight.Token.Column,
+				Offset:  weight.Token.Offset,
+				Message: "Random option weight must be greater than 0",
+			}
+		}
+	}
+
+	// Parse optional condition
+	var condition ast.Expression
+	if p.check(token.IF) {
+		p.advance() // consume IF
+
+		var err *ParseError
+		condition, err = p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.check(token.LBRACE) {
+		return nil, p.expected("'{' for random option")
+	}
+
+	body, err := p.parseBlockStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse optional tags after the body
+	var tags *ast.TagList
+	if p.check(token.LBRACKET) {
+		tags, err = p.parseTagList()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ast.RandomOption{
+		Weight:    weight,
+		Condition: condition,
+		Body:      body,
+		Tags:      tags,
+	}, nil
+}
 
 // Expression parsing with precedence
 const (
 	_ int = iota
 	LOWEST
-	EQUALS      // ==
-	LESSGREATER // > or <
+	COALESCE    // ??
+	EQUALS      // == or IN
+	LESSGREATER // > or <, && or ||
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
+	INDEX       // list[0]
 )
 
 var precedences = map[token.TokenType]int{
-	token.NULL_COALESCE: LOWEST + 1, // Null coalescing has low precedence
+	token.NULL_COALESCE: COALESCE, // Null coalescing has low precedence
 	token.EQ:            EQUALS,
 	token.NE:            EQUALS,
 	token.LT:            LESSGREATER,
@@ -567,6 +911,11 @@ var precedences = map[token.TokenType]int{
 	token.OR:            LESSGREATER,
 	token.PLUS:          SUM,
 	token.MINUS:         SUM,
+	token.STAR:          PRODUCT,
+	token.SLASH:         PRODUCT,
+	token.PERCENT:       PRODUCT,
+	token.IN:            EQUALS,
+	token.LBRACKET:      INDEX,
 }
 
 func (p *Parser) parseExpression() (ast.Expression, *ParseError) {
@@ -582,6 +931,17 @@ func (p *Parser) parseExpressionWithPrecedence(precedence int) (ast.Expression,
 
 	// Parse infix expressions
 	for !p.isAtEnd() && precedence < p.peekPrecedence() {
+		if p.check(token.LBRACKET) {
+			if p.tagsFollow {
+				break
+			}
+			left, err = p.parseIndexExpression(left)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		left, err = p.parseInfixExpression(left)
 		if err != nil {
 			return nil, err
@@ -597,21 +957,30 @@ func (p *Parser) parsePrefixExpression() (ast.Expression, *ParseError) {
 		return p.parseIdentifier(), nil
 	case token.INT:
 		return p.parseIntegerLiteral()
+	case token.FLOAT:
+		return p.parseFloatLiteral()
 	case token.STRING:
-		return p.parseStringLiteral(), nil
+		return p.parseStringLiteral()
 	case token.TRUE, token.FALSE:
 		return p.parseBooleanLiteral(), nil
-	case token.NOT:
-		return p.parseNotExpression()
+	case token.NOT, token.MINUS:
+		return p.parsePrefixOperatorExpression()
 	case token.LPAREN:
 		return p.parseGroupedExpression()
 	case token.TOOL_CALL:
 		return p.parseToolCall()
+	case token.LBRACKET:
+		return p.parseListLiteral()
+	case token.LBRACE:
+		return p.parseMapLiteral()
+	case token.VISITS:
+		return p.parseVisitsExpression()
+	case token.TURNS:
+		turns := &ast.TurnsExpression{Token: p.peek()}
+		p.advance()
+		return turns, nil
 	default:
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "No prefix parse function for " + string(p.peek().Type),
-		}
+		return nil, p.expected("an expression")
 	}
 }
 
@@ -653,6 +1022,8 @@ func (p *Parser) parseIntegerLiteral() (ast.Expression, *ParseError) {
 		if char < '0' || char > '9' {
 			return nil, &ParseError{
 				Line:    p.peek().Line,
+				Column:  p.peek().Column,
+				Offset:  p.peek().Offset,
 				Message: "Invalid integer literal",
 			}
 		}
@@ -664,173 +1035,314 @@ func (p *Parser) parseIntegerLiteral() (ast.Expression, *ParseError) {
 	return lit, nil
 }
 
-func (p *Parser) parseStringLiteral() ast.Expression {
+func (p *Parser) parseFloatLiteral() (ast.Expression, *ParseError) {
+	value, err := strconv.ParseFloat(p.peek().Lexeme, 64)
+	if err != nil {
+		return nil, &ParseError{
+			Line:    p.peek().Line,
+			Column:  p.peek().Column,
+			Offset:  p.peek().Offset,
+			Message: "Invalid float literal",
+		}
+	}
+
+	lit := &ast.FloatLiteral{
+		Token: p.peek(),
+		Value: value,
+	}
+	p.advance()
+	return lit, nil
+}
+
+func (p *Parser) parseStringLiteral() (ast.Expression, *ParseError) {
 	stringToken := p.peek()
 	stringValue := p.peek().Literal.(string)
+	p.advance()
 
-	// Check if the string contains variable interpolation
-	if p.containsInterpolation(stringValue) {
-		return p.parseInterpolatedString(stringToken, stringValue)
+	parts, err := p.parseInterpolatedString(stringToken, stringValue)
+	if err != nil {
+		return nil, err
 	}
 
 	// Regular string literal
-	lit := &ast.StringLiteral{
-		Token: stringToken,
-		Value: stringValue,
+	if len(parts) == 0 {
+		return &ast.StringLiteral{
+			Token: stringToken,
+			Value: "",
+		}, nil
 	}
-	p.advance()
-	return lit
-}
-
-func (p *Parser) containsInterpolation(str string) bool {
-	for i, char := range str {
-		if char == '{' && i+1 < len(str) {
-			// Look for a closing brace
-			for j := i + 1; j < len(str); j++ {
-				if str[j] == '}' {
-					return true
-				}
-			}
-		}
-		if char == '<' && i+1 < len(str) {
-			// Look for a closing angle bracket (tool call)
-			for j := i + 1; j < len(str); j++ {
-				if str[j] == '>' {
-					return true
-				}
-			}
-		}
+	if literal, ok := parts[0].(*ast.StringLiteral); ok && len(parts) == 1 {
+		return literal, nil
 	}
-	return false
+
+	return &ast.InterpolatedString{
+		Token: stringToken,
+		Parts: parts,
+	}, nil
 }
 
-func (p *Parser) parseInterpolatedString(stringToken token.Token, stringValue string) ast.Expression {
+// parseInterpolatedString splits a string into text and the expressions
+// written in braces, such as "You have {gold + 5} coins", and the tool calls
+// written in angle brackets
+func (p *Parser) parseInterpolatedString(stringToken token.Token, stringValue string) ([]ast.Expression, *ParseError) {
 	var parts []ast.Expression
 	current := ""
 
+	addText := func() {
+		if current != "" {
+			parts = append(parts, &ast.StringLiteral{
+				Token: stringToken,
+				Value: current,
+			})
+			current = ""
+		}
+	}
+
 	for i := 0; i < len(stringValue); i++ {
-		if stringValue[i] == '{' {
-			// Add current string part if not empty
-			if current != "" {
-				parts = append(parts, &ast.StringLiteral{
-					Token: stringToken,
-					Value: current,
-				})
-				current = ""
+		switch {
+		case stringValue[i] == '\\' && i+1 < len(stringValue):
+			i++
+			current += unescape(stringValue[i])
+
+		case stringValue[i] == '{':
+			// A '{' that is never closed is plain text, like in the scanner
+			end := closingBrace(stringValue, i)
+			if end == -1 {
+				current += stringValue[i : i+1]
+				continue
 			}
 
-			// Find the closing brace
-			j := i + 1
-			for j < len(stringValue) && stringValue[j] != '}' {
-				j++
+			source := stringValue[i+1 : end]
+			if strings.TrimSpace(source) == "" {
+				brace := positionIn(stringToken, i+1)
+				return nil, &ParseError{
+					Line:    brace.Line,
+					Column:  brace.Column,
+					Offset:  brace.Offset,
+					Message: "Expected expression inside '{}' in string",
+				}
 			}
 
-			if j < len(stringValue) {
-				// Extract variable name
-				varName := stringValue[i+1 : j]
-				parts = append(parts, &ast.Identifier{
-					Token: token.Token{
-						Type:    token.IDENT,
-						Lexeme:  varName,
-						Literal: nil,
-						Line:    stringToken.Line,
-					},
-					Value: varName,
-				})
-				i = j // Skip past the closing brace
+			expression, err := p.parseInterpolation(source, positionIn(stringToken, i+2))
+			if err != nil {
+				return nil, err
 			}
-		} else if stringValue[i] == '<' {
-			// Add current string part if not empty
-			if current != "" {
-				parts = append(parts, &ast.StringLiteral{
-					Token: stringToken,
-					Value: current,
-				})
-				current = ""
+
+			addText()
+			parts = append(parts, expression)
+			i = end // Skip past the closing brace
+
+		case stringValue[i] == '<' && isIdentifierStart(stringValue[i+1:]):
+			end := closingAngle(stringValue, i)
+			if end == -1 {
+				current += stringValue[i : i+1]
+				continue
 			}
 
-			// Find the closing angle bracket
-			j := i + 1
-			for j < len(stringValue) && stringValue[j] != '>' {
-				j++
+			// The tool call is parsed like one outside of a string
+			expression, err := p.parseInterpolation(stringValue[i:end+1], positionIn(stringToken, i+1))
+			if err != nil {
+				return nil, err
 			}
 
-			if j < len(stringValue) {
-				// Extract tool call content including angle brackets
-				toolCallContent := stringValue[i : j+1]
+			addText()
+			parts = append(parts, expression)
+			i = end // Skip past the closing angle bracket
 
-				// Create a mock token for the tool call
-				toolCallToken := token.Token{
-					Type:    token.TOOL_CALL,
-					Lexeme:  toolCallContent,
-					Literal: toolCallContent,
-					Line:    stringToken.Line,
-				}
+		default:
+			current += stringValue[i : i+1]
+		}
+	}
 
-				// Parse the tool call content
-				inner := toolCallContent[1 : len(toolCallContent)-1] // Remove < and >
-
-				// Split by semicolon to separate function name from arguments
-				colonIndex := strings.Index(inner, ";")
-				functionName := inner
-				var arguments []ast.Expression
-
-				if colonIndex != -1 {
-					functionName = strings.TrimSpace(inner[:colonIndex])
-					argString := strings.TrimSpace(inner[colonIndex+1:])
-
-					if argString != "" {
-						// Split arguments by comma (simple split for now)
-						args := strings.Split(argString, ",")
-						for _, arg := range args {
-							arg = strings.TrimSpace(arg)
-							if arg == "" {
-								continue
-							}
-
-							// Create a simple expression for the argument
-							if arg[0] == '"' && arg[len(arg)-1] == '"' {
-								// String literal
-								arguments = append(arguments, &ast.StringLiteral{
-									Token: toolCallToken,
-									Value: arg[1 : len(arg)-1], // Remove quotes
-								})
-							} else {
-								// Identifier
-								arguments = append(arguments, &ast.Identifier{
-									Token: toolCallToken,
-									Value: arg,
-								})
-							}
-						}
-					}
-				}
+	addText()
+	return parts, nil
+}
 
-				parts = append(parts, &ast.ToolCall{
-					Token:     toolCallToken,
-					Function:  functionName,
-					Arguments: arguments,
-				})
-				i = j // Skip past the closing angle bracket
-			}
+// parseInterpolation parses the single expression of an interpolation
+func (p *Parser) parseInterpolation(source string, at token.Token) (ast.Expression, *ParseError) {
+	child, err := p.fragmentParser(source, at)
+	if err != nil {
+		return nil, err
+	}
+
+	child.skipNewlines()
+
+	var expression ast.Expression
+	switch {
+	case child.check(token.IF):
+		expression, err = child.parseConditionalText()
+	case child.check(token.TILDE):
+		expression, err = child.parseAlternativeText()
+	default:
+		expression, err = child.parseExpression()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	child.skipNewlines()
+	if !child.isAtEnd() {
+		return nil, child.expected("'}' to end the string interpolation")
+	}
+
+	return expression, nil
+}
+
+// parseConditionalText parses {IF condition: text ELSE text} in a string,
+// where ELSE may be followed by another IF
+func (p *Parser) parseConditionalText() (ast.Expression, *ParseError) {
+	ifToken := p.peek()
+	p.advance() // consume IF
+
+	condition, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.check(token.COLON) {
+		return nil, p.expected("':' after inline IF condition")
+	}
+	p.advance() // consume ':'
+
+	consequence, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	conditional := &ast.ConditionalText{
+		Token:       ifToken,
+		Condition:   condition,
+		Consequence: consequence,
+	}
+
+	if p.check(token.ELSE) {
+		p.advance() // consume ELSE
+
+		if p.check(token.IF) {
+			conditional.Alternative, err = p.parseConditionalText()
 		} else {
-			current += string(stringValue[i])
+			conditional.Alternative, err = p.parseExpression()
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	// Add remaining string part
-	if current != "" {
-		parts = append(parts, &ast.StringLiteral{
-			Token: stringToken,
-			Value: current,
-		})
+	return conditional, nil
+}
+
+// parseAlternativeText parses {~text|text} in a string, one of the options
+// is picked at random every time the string is evaluated
+func (p *Parser) parseAlternativeText() (ast.Expression, *ParseError) {
+	alternative := &ast.AlternativeText{
+		Token: p.peek(),
 	}
+	p.advance() // consume '~'
 
-	p.advance()
-	return &ast.InterpolatedString{
-		Token: stringToken,
-		Parts: parts,
+	for {
+		option, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		alternative.Options = append(alternative.Options, option)
+
+		if !p.check(token.PIPE) {
+			break
+		}
+		p.advance() // consume '|'
 	}
+
+	return alternative, nil
+}
+
+// closingBrace returns the index of the '}' that closes the '{' at start,
+// skipping nested braces and quoted strings, or -1 if there is none
+func closingBrace(s string, start int) int {
+	depth := 0
+	inString := false
+
+	for i := start; i < len(s); i++ {
+		switch {
+		case inString:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				inString = false
+			}
+		case s[i] == '"':
+			inString = true
+		case s[i] == '{':
+			depth++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// closingAngle returns the index of the '>' that closes the tool call at
+// start, skipping quoted strings, or -1 if there is none
+func closingAngle(s string, start int) int {
+	inString := false
+
+	for i := start; i < len(s); i++ {
+		switch {
+		case inString:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				inString = false
+			}
+		case s[i] == '"':
+			inString = true
+		case s[i] == '>':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unescape returns the character an escape sequence such as \n stands for,
+// the scanner only lets valid escape sequences through
+func unescape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	default:
+		return string(c)
+	}
+}
+
+// unescapeString decodes the escape sequences of a string without interpolation
+func unescapeString(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	result := ""
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			result += unescape(s[i])
+			continue
+		}
+		result += s[i : i+1]
+	}
+	return result
+}
+
+// isIdentifierStart reports whether s starts with a letter of any script or
+// '_', the same characters the scanner starts identifiers with
+func isIdentifierStart(s string) bool {
+	c, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(c) || c == '_'
 }
 
 func (p *Parser) parseBooleanLiteral() ast.Expression {
@@ -842,7 +1354,7 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseNotExpression() (ast.Expression, *ParseError) {
+func (p *Parser) parsePrefixOperatorExpression() (ast.Expression, *ParseError) {
 	operator := p.peek()
 	p.advance()
 
@@ -858,51 +1370,239 @@ func (p *Parser) parseNotExpression() (ast.Expression, *ParseError) {
 	}, nil
 }
 
+// parseNestedExpression parses an expression inside brackets or parentheses,
+// where a '[' is always an index
+func (p *Parser) parseNestedExpression() (ast.Expression, *ParseError) {
+	tagsFollow := p.tagsFollow
+	p.tagsFollow = false
+	defer func() { p.tagsFollow = tagsFollow }()
+
+	return p.parseExpression()
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) (ast.Expression, *ParseError) {
+	indexToken := p.peek()
+	p.advance() // consume '['
+
+	index, err := p.parseNestedExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.check(token.RBRACKET) {
+		return nil, p.expected("']' after index")
+	}
+	p.advance() // consume ']'
+
+	return &ast.IndexExpression{
+		Token: indexToken,
+		Left:  left,
+		Index: index,
+	}, nil
+}
+
+func (p *Parser) parseListLiteral() (ast.Expression, *ParseError) {
+	list := &ast.ListLiteral{Token: p.peek()}
+	p.advance() // consume '['
+
+	for {
+		p.skipNewlines()
+		if p.check(token.RBRACKET) || p.isAtEnd() {
+			break
+		}
+
+		element, err := p.parseNestedExpression()
+		if err != nil {
+			return nil, err
+		}
+		list.Elements = append(list.Elements, element)
+
+		p.skipNewlines()
+		if !p.check(token.COMMA) {
+			break
+		}
+		p.advance() // consume ','
+	}
+
+	if !p.check(token.RBRACKET) {
+		return nil, p.expected("']' to close list")
+	}
+	p.advance() // consume ']'
+
+	return list, nil
+}
+
+func (p *Parser) parseMapLiteral() (ast.Expression, *ParseError) {
+	mapLiteral := &ast.MapLiteral{Token: p.peek()}
+	p.advance() // consume '{'
+
+	for {
+		p.skipNewlines()
+		if p.check(token.RBRACE) || p.isAtEnd() {
+			break
+		}
+
+		key, err := p.parseNestedExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.check(token.COLON) {
+			return nil, p.expected("':' after map key")
+		}
+		p.advance() // consume ':'
+		p.skipNewlines()
+
+		value, err := p.parseNestedExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		mapLiteral.Keys = append(mapLiteral.Keys, key)
+		mapLiteral.Values = append(mapLiteral.Values, value)
+
+		p.skipNewlines()
+		if !p.check(token.COMMA) {
+			break
+		}
+		p.advance() // consume ','
+	}
+
+	if !p.check(token.RBRACE) {
+		return nil, p.expected("'}' to close map")
+	}
+	p.advance() // consume '}'
+
+	return mapLiteral, nil
+}
+
+// skipNewlines skips line breaks and comments, used inside multi-line literals
+func (p *Parser) skipNewlines() {
+	for p.check(token.NEWLINE) || p.check(token.COMMENT) {
+		p.advance()
+	}
+}
+
+func (p *Parser) parseVisitsExpression() (ast.Expression, *ParseError) {
+	visitsToken := p.peek()
+	p.advance() // consume VISITS
+
+	if !p.check(token.LPAREN) {
+		return nil, p.expected("'(' after VISITS")
+	}
+	p.advance() // consume '('
+
+	if !p.check(token.IDENT) {
+		return nil, p.expected("name in VISITS")
+	}
+	name := p.parseQualifiedIdentifier()
+
+	if !p.check(token.RPAREN) {
+		return nil, p.expected("')' after VISITS name")
+	}
+	p.advance() // consume ')'
+
+	return &ast.VisitsExpression{
+		Token: visitsToken,
+		Name:  name,
+	}, nil
+}
+
 func (p *Parser) parseGroupedExpression() (ast.Expression, *ParseError) {
 	p.advance() // consume '('
 
-	exp, err := p.parseExpression()
+	exp, err := p.parseNestedExpression()
 	if err != nil {
 		return nil, err
 	}
 
 	if !p.check(token.RPAREN) {
-		return nil, &ParseError{
-			Line:    p.peek().Line,
-			Message: "Expected ')' after grouped expression",
-		}
+		return nil, p.expected("')' after grouped expression")
 	}
 
 	p.advance() // consume ')'
 	return exp, nil
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peek().Type]; ok {
+// Precedence returns how strongly an infix operator binds, LOWEST for tokens
+// that are not operators
+func Precedence(tokenType token.TokenType) int {
+	if p, ok := precedences[tokenType]; ok {
 		return p
 	}
 	return LOWEST
 }
 
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peek().Type)
+}
+
 func (p *Parser) currentPrecedence() int {
-	if p, ok := precedences[p.peek().Type]; ok {
-		return p
+	return Precedence(p.peek().Type)
+}
+
+// report records an error so parsing can continue after it. An error at the
+// position of the previous one, at a character the scanner rejected or at the
+// end of a file that ends in an unterminated string or tool call is a
+// follow-on error and is dropped.
+func (p *Parser) report(err *ParseError) {
+	if err.File == "" {
+		err.File = p.file
 	}
-	return LOWEST
+	if p.peek().Type == token.ILLEGAL {
+		return
+	}
+	if p.isAtEnd() && p.current > 0 && p.tokens[p.current-1].Type == token.ILLEGAL {
+		return
+	}
+	if count := len(p.errors); count > 0 && p.errors[count-1].File == err.File && p.errors[count-1].Offset == err.Offset {
+		return
+	}
+	p.errors = append(p.errors, *err)
 }
 
-// Helper function for error recovery
+// synchronize skips the rest of a statement after an error, up to the end of
+// its line or the '}' that closes the enclosing block
 func (p *Parser) synchronize() {
-	p.advance()
+	p.skipRest(false)
+}
 
-	for !p.isAtEnd() {
-		if p.tokens[p.current-1].Type == token.NEWLINE {
-			return
-		}
+// synchronizeOption skips the rest of an option of a CHOICE, RANDOM, MATCH or
+// sequence block after an error, which also ends at a ','
+func (p *Parser) synchronizeOption() {
+	p.skipRest(true)
+}
+
+// skipRest skips tokens up to the end of the line, a ',' if atComma is set,
+// or a '}' that is not opened after the error. Blocks are skipped as a whole,
+// so errors inside them are not reported again.
+func (p *Parser) skipRest(atComma bool) {
+	start := p.current
+	depth := 0
 
+	for !p.isAtEnd() {
 		switch p.peek().Type {
-		case token.LABEL, token.GOTO, token.CHOICE, token.END:
-			return
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.NEWLINE:
+			if depth == 0 {
+				p.advance()
+				return
+			}
+		case token.COMMA:
+			if depth == 0 && atComma {
+				p.advance()
+				return
+			}
+		case token.LABEL, token.GOTO, token.CHOICE, token.END, token.SCENE, token.CALL, token.INCLUDE:
+			if depth == 0 && p.current > start {
+				return
+			}
 		}
 
 		p.advance()
@@ -919,6 +1619,8 @@ func (p *Parser) parseToolCall() (ast.Expression, *ParseError) {
 	if len(content) < 2 || content[0] != '<' || content[len(content)-1] != '>' {
 		return nil, &ParseError{
 			Line:    token.Line,
+			Column:  token.Column,
+			Offset:  token.Offset,
 			Message: "Invalid tool call format",
 		}
 	}
@@ -966,6 +1668,8 @@ func (p *Parser) parseToolCall() (ast.Expression, *ParseError) {
 	if len(parts) == 0 {
 		return nil, &ParseError{
 			Line:    token.Line,
+			Column:  token.Column,
+			Offset:  token.Offset,
 			Message: "Tool call must have a function name",
 		}
 	}
@@ -975,104 +1679,109 @@ func (p *Parser) parseToolCall() (ast.Expression, *ParseError) {
 	// Parse arguments if they exist
 	var arguments []ast.Expression
 	if len(parts) > 1 {
-		argString := strings.TrimSpace(parts[1])
-		if argString != "" {
-			// Split arguments by comma (but respect string literals)
-			args := []string{}
-			current := ""
-			inString := false
-			escaped := false
-
-			for _, char := range argString {
-				if escaped {
-					current += string(char)
-					escaped = false
-					continue
-				}
+		var err *ParseError
+		arguments, err = p.parseToolCallArguments(strings.Join(parts[1:], ";"), positionIn(token, len(parts[0])+2))
+		if err != nil {
+			return nil, err
+		}
+	}
 
-				if char == '\\' {
-					escaped = true
-					current += string(char)
-					continue
-				}
+	return &ast.ToolCall{
+		Token:     token,
+		Function:  functionName,
+		Arguments: arguments,
+	}, nil
+}
 
-				if char == '"' {
-					inString = !inString
-					current += string(char)
-					continue
-				}
+// parseToolCallArguments parses the comma separated arguments of a tool call
+// with the expression parser, so they can be any expression
+func (p *Parser) parseToolCallArguments(source string, at token.Token) ([]ast.Expression, *ParseError) {
+	child, err := p.fragmentParser(source, at)
+	if err != nil {
+		return nil, err
+	}
 
-				if char == ',' && !inString {
-					args = append(args, strings.TrimSpace(current))
-					current = ""
-					continue
-				}
+	var arguments []ast.Expression
+	for {
+		child.skipNewlines()
+		if child.isAtEnd() {
+			break
+		}
 
-				current += string(char)
-			}
+		argument, err := child.parseExpression()
+		if err != nil {
+			return nil, err
+		}
 
-			if current != "" {
-				args = append(args, strings.TrimSpace(current))
+		// Lowercase booleans were accepted in tool calls before they were parsed as expressions
+		if identifier, ok := argument.(*ast.Identifier); ok && (identifier.Value == "true" || identifier.Value == "false") {
+			argument = &ast.BooleanLiteral{
+				Token: identifier.Token,
+				Value: identifier.Value == "true",
 			}
+		}
+		arguments = append(arguments, argument)
 
-			// Parse each argument as an expression
-			for _, arg := range args {
-				arg = strings.TrimSpace(arg)
-				if arg == "" {
-					continue
-				}
+		child.skipNewlines()
+		if child.isAtEnd() {
+			break
+		}
+		if !child.check(token.COMMA) {
+			return nil, child.expected("',' between tool call arguments")
+		}
+		child.advance() // consume ','
+	}
 
-				// Create a simple parser for the argument
-				if arg[0] == '"' && arg[len(arg)-1] == '"' {
-					// String literal
-					arguments = append(arguments, &ast.StringLiteral{
-						Token: token,
-						Value: arg[1 : len(arg)-1], // Remove quotes
-					})
-				} else if arg == "true" || arg == "false" {
-					// Boolean literal
-					arguments = append(arguments, &ast.BooleanLiteral{
-						Token: token,
-						Value: arg == "true",
-					})
-				} else if isNumber(arg) {
-					// Integer literal
-					value := int64(0)
-					for _, char := range arg {
-						if char >= '0' && char <= '9' {
-							value = value*10 + int64(char-'0')
-						}
-					}
-					arguments = append(arguments, &ast.IntegerLiteral{
-						Token: token,
-						Value: value,
-					})
-				} else {
-					// Identifier
-					arguments = append(arguments, &ast.Identifier{
-						Token: token,
-						Value: arg,
-					})
-				}
-			}
+	return arguments, nil
+}
+
+// fragmentParser creates a parser for source code that is embedded in a
+// token, such as the arguments of a tool call or an interpolation in a
+// string. The fragment starts at the position of at.
+func (p *Parser) fragmentParser(source string, at token.Token) (*Parser, *ParseError) {
+	tokens, scannerErrors := scanner.NewWithFile(source, p.file).ScanTokens()
+	if len(scannerErrors) > 0 {
+		scannerError := scannerErrors[0]
+		return nil, &ParseError{
+			Line:    at.Line + scannerError.Line - 1,
+			Column:  fragmentColumn(at, scannerError.Line, scannerError.Column),
+			Offset:  at.Offset + scannerError.Offset,
+			Message: scannerError.Message,
 		}
 	}
 
-	return &ast.ToolCall{
-		Token:     token,
-		Function:  functionName,
-		Arguments: arguments,
+	// The fragment is scanned on its own, move it to the position of its token
+	for idx := range tokens {
+		tokens[idx].Column = fragmentColumn(at, tokens[idx].Line, tokens[idx].Column)
+		tokens[idx].Line += at.Line - 1
+		tokens[idx].Offset += at.Offset
+	}
+
+	return &Parser{
+		tokens: tokens,
+		file:   p.file,
 	}, nil
 }
 
-func isNumber(s string) bool {
-	if len(s) == 0 {
-		return false
+// fragmentColumn moves a column on the first line of a fragment behind the
+// column the fragment starts at
+func fragmentColumn(at token.Token, line int, column int) int {
+	if line == 1 {
+		return at.Column + column - 1
 	}
-	for _, char := range s {
-		if char < '0' || char > '9' {
-			return false
-		}
+	return column
+}
+
+// positionIn returns tok moved to the byte index of its lexeme
+func positionIn(tok token.Token, index int) token.Token {
+	prefix := tok.Lexeme[:index]
+
+	if newline := strings.LastIndexByte(prefix, '\n'); newline != -1 {
+		tok.Line += strings.Count(prefix, "\n")
+		tok.Column = utf8.RuneCountInString(prefix[newline+1:]) + 1
+	} else {
+		tok.Column += utf8.RuneCountInString(prefix)
 	}
-	return true
+	tok.Offset += index
+	return tok
 }
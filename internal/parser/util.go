@@ -33,3 +33,36 @@ func (p *Parser) checkNext(tokenType token.TokenType) bool {
 	}
 	return p.tokens[p.current+1].Type == tokenType
 }
+
+// expected creates an error for a current token that is not what the grammar
+// requires, such as "Expected ':' after character name, found end of line"
+func (p *Parser) expected(what string) *ParseError {
+	found := p.peek()
+	return &ParseError{
+		Line:    found.Line,
+		Column:  found.Column,
+		Offset:  found.Offset,
+		Message: "Expected " + what + ", found " + describeToken(found),
+	}
+}
+
+func describeToken(t token.Token) string {
+	switch t.Type {
+	case token.EOF:
+		return "end of file"
+	case token.NEWLINE:
+		return "end of line"
+	case token.STRING:
+		return "string " + t.Lexeme
+	case token.INT, token.FLOAT:
+		return "number " + t.Lexeme
+	case token.IDENT:
+		return "name '" + t.Lexeme + "'"
+	case token.TOOL_CALL:
+		return "tool call " + t.Lexeme
+	case token.COMMENT:
+		return "comment"
+	default:
+		return "'" + t.Lexeme + "'"
+	}
+}
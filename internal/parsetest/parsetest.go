@@ -0,0 +1,24 @@
+// Package parsetest parses scripts for the tests of other packages
+package parsetest
+
+import (
+	"quill/internal/ast"
+	"quill/internal/parser"
+	"quill/internal/scanner"
+	"testing"
+)
+
+// Parse scans and parses a script and fails the test on any error
+func Parse(t testing.TB, source string) *ast.Program {
+	t.Helper()
+
+	tokens, scannerErrors := scanner.New(source).ScanTokens()
+	if len(scannerErrors) > 0 {
+		t.Fatalf("scanner errors: %v", scannerErrors)
+	}
+	program, parserErrors := parser.New(tokens).Parse()
+	if len(parserErrors) > 0 {
+		t.Fatalf("parser errors: %v", parserErrors)
+	}
+	return program
+}
@@ -0,0 +1,68 @@
+package playtest
+
+// context is the number of equal lines shown around a difference
+const context = 2
+
+// Diff compares an expected and an actual transcript line by line. Lines only
+// expected start with "- ", lines only in the actual transcript with "+ " and
+// equal lines with two spaces. Long runs of equal lines are shortened to "...".
+func Diff(expected []string, actual []string) []string {
+	// lengths[i][j] is the length of the longest common subsequence of expected[i:] and actual[j:]
+	lengths := make([][]int, len(expected)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			lines = append(lines, "  "+expected[i])
+			i++
+			j++
+		case j < len(actual) && (i == len(expected) || lengths[i][j+1] >= lengths[i+1][j]):
+			lines = append(lines, "+ "+actual[j])
+			j++
+		default:
+			lines = append(lines, "- "+expected[i])
+			i++
+		}
+	}
+
+	return shorten(lines)
+}
+
+// shorten keeps only the equal lines near a difference
+func shorten(lines []string) []string {
+	changed := func(idx int) bool {
+		return idx >= 0 && idx < len(lines) && lines[idx][0] != ' '
+	}
+
+	var result []string
+	skipped := false
+	for idx, line := range lines {
+		near := false
+		for offset := -context; offset <= context; offset++ {
+			near = near || changed(idx+offset)
+		}
+
+		if near {
+			result = append(result, line)
+			skipped = false
+		} else if !skipped {
+			result = append(result, "  ...")
+			skipped = true
+		}
+	}
+	return result
+}
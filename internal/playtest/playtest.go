@@ -0,0 +1,288 @@
+package playtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"quill/internal/interpreter"
+	"quill/internal/parser"
+	"quill/internal/scanner"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxSteps stops scripts that keep showing dialog without asking for a choice
+const maxSteps = 100000
+
+// stepLimit stops scripts that loop without showing dialog or asking for a
+// choice, which would never return a result to count
+const stepLimit = 10000
+
+// Test is a scripted playthrough read from a JSON test file. The script is
+// played with the given choices and tool responses, and the transcript of
+// dialog and choices it produces must match the expected one.
+type Test struct {
+	Script     string         `json:"script"`         // path of the script, relative to the test file
+	Seed       uint64         `json:"seed,omitempty"` // seed for RANDOM blocks
+	Choices    []Choice       `json:"choices"`
+	Tools      []ToolResponse `json:"tools,omitempty"`
+	Transcript []string       `json:"transcript"`
+}
+
+// Choice picks an option by its number among the options shown, counted
+// from 1, or by its text. It is written as a number or a string.
+type Choice struct {
+	Number int
+	Text   string
+}
+
+func (c *Choice) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.Text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &c.Number); err != nil {
+		return fmt.Errorf("a choice must be an option number or text, got %s", data)
+	}
+	return nil
+}
+
+func (c Choice) MarshalJSON() ([]byte, error) {
+	if c.Text != "" {
+		return json.Marshal(c.Text)
+	}
+	return json.Marshal(c.Number)
+}
+
+func (c Choice) String() string {
+	if c.Text != "" {
+		return strconv.Quote(c.Text)
+	}
+	return strconv.Itoa(c.Number)
+}
+
+// ToolResponse is the result a tool call returns. Without arguments it
+// answers every call of the function, otherwise only calls with arguments
+// equal to them. The first matching response is used.
+type ToolResponse struct {
+	Function  string        `json:"function"`
+	Arguments []interface{} `json:"arguments,omitempty"`
+	Result    interface{}   `json:"result"`
+}
+
+// Matches reports whether the response answers a call of function with arguments
+func (t ToolResponse) Matches(function string, arguments []interface{}) bool {
+	if t.Function != function {
+		return false
+	}
+	if t.Arguments == nil {
+		return true
+	}
+	return encode(t.Arguments) == encode(arguments)
+}
+
+// encode writes a value as JSON, so decoded test values and script values
+// compare equal when they are the same
+func encode(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// ScriptFile returns the path of the script played by the test in file
+func (t *Test) ScriptFile(file string) string {
+	return filepath.Join(filepath.Dir(file), t.Script)
+}
+
+// Load reads a test file
+func Load(file string) (*Test, error) {
+	var test Test
+	if err := decode(file, &test); err != nil {
+		return nil, fmt.Errorf("invalid test file %s: %v", file, err)
+	}
+	if test.Script == "" {
+		return nil, fmt.Errorf("invalid test file %s: no script given", file)
+	}
+	return &test, nil
+}
+
+// LoadTools reads a JSON file holding a list of tool responses
+func LoadTools(file string) ([]ToolResponse, error) {
+	var tools []ToolResponse
+	if err := decode(file, &tools); err != nil {
+		return nil, fmt.Errorf("invalid tool file %s: %v", file, err)
+	}
+	return tools, nil
+}
+
+// decode reads a JSON file. Numbers stay ints unless they have a fraction or
+// exponent, as in tool call responses of the JSON API.
+func decode(file string, value interface{}) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(value)
+}
+
+// Save writes a test file, used to record the transcript of a playthrough
+func Save(file string, test *Test) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(test); err != nil {
+		return err
+	}
+	return os.WriteFile(file, buffer.Bytes(), 0644)
+}
+
+// Result is the outcome of a playthrough
+type Result struct {
+	Transcript []string // what the script showed
+	Failures   []string // problems besides a different transcript
+}
+
+// Passed reports whether the playthrough went as the test expects
+func (r *Result) Passed(test *Test) bool {
+	return len(r.Failures) == 0 && slices.Equal(r.Transcript, test.Transcript)
+}
+
+// Run plays the test's script. The file is the test file, the script path is
+// relative to it. The options are passed on to the interpreter.
+func Run(file string, test *Test, options ...interpreter.Option) *Result {
+	result := &Result{Transcript: []string{}}
+
+	scriptFile := test.ScriptFile(file)
+	source, err := os.ReadFile(scriptFile)
+	if err != nil {
+		result.fail("Cannot read script: %v", err)
+		return result
+	}
+
+	tokens, scannerErrors := scanner.NewWithFile(string(source), scriptFile).ScanTokens()
+	scriptParser := parser.NewWithLoader(tokens, parser.FileLoader)
+	program, parserErrors := scriptParser.Parse()
+	scannerErrors = append(scannerErrors, scriptParser.ScannerErrors()...)
+	for _, err := range scannerErrors {
+		result.fail("ScannerError in %s at line %d, column %d: %s", err.File, err.Line, err.Column, err.Message)
+	}
+	for _, err := range parserErrors {
+		result.fail("ParseError in %s at line %d, column %d: %s", err.File, err.Line, err.Column, err.Message)
+	}
+	if len(result.Failures) > 0 {
+		return result
+	}
+
+	interp := interpreter.New(program, append([]interpreter.Option{interpreter.WithSeed(test.Seed), interpreter.WithStepLimit(stepLimit)}, options...)...)
+	choices := test.Choices
+
+	// Results returned by choice and tool call handling are processed like steps
+	var next *interpreter.InterpreterResult
+
+	for steps := 0; !interp.IsEnded() || next != nil; steps++ {
+		if steps == maxSteps {
+			result.fail("Script did not end after %d steps", maxSteps)
+			return result
+		}
+
+		step := next
+		next = nil
+		if step == nil {
+			step = interp.Step()
+		}
+
+		switch step.Type {
+		case interpreter.DialogResult:
+			data := step.Data.(interpreter.DialogData)
+			result.record(data.Character+": "+data.Text, data.Tags)
+
+		case interpreter.ChoiceResult:
+			data := step.Data.(interpreter.ChoiceData)
+			for _, option := range data.Options {
+				result.record("* "+option.Text, option.Tags)
+			}
+
+			if len(choices) == 0 {
+				result.fail("Script asks for a choice, but the test has no choices left")
+				return result
+			}
+			option, found := pick(data.Options, choices[0])
+			if !found {
+				result.fail("Choice %s is not one of the %d options shown", choices[0], len(data.Options))
+				return result
+			}
+			choices = choices[1:]
+
+			result.Transcript = append(result.Transcript, "> "+option.Text)
+			next = interp.HandleChoiceInput(option.Index)
+
+		case interpreter.ToolCallResult:
+			data := step.Data.(interpreter.ToolCallData)
+			response, found := findResponse(test.Tools, data.Function, data.Arguments)
+			if !found {
+				result.fail("No response for tool call %s(%s)", data.Function, strings.Trim(encode(data.Arguments), "[]"))
+				return result
+			}
+			next = interp.HandleToolCallResponse(response)
+
+		case interpreter.EndResult:
+			continue
+
+		case interpreter.ErrorResult:
+			data := step.Data.(interpreter.ErrorData)
+			result.fail("Runtime Error at line %d, column %d: %s", data.Line, data.Column, data.Message)
+			return result
+		}
+	}
+
+	if len(choices) > 0 {
+		result.fail("Script ended with %d choices left", len(choices))
+	}
+	return result
+}
+
+func (r *Result) record(line string, tags []string) {
+	if len(tags) > 0 {
+		line += " [" + strings.Join(tags, ", ") + "]"
+	}
+	r.Transcript = append(r.Transcript, line)
+}
+
+func (r *Result) fail(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// pick returns the option a choice of the test selects
+func pick(options []interpreter.ChoiceOption, choice Choice) (interpreter.ChoiceOption, bool) {
+	if choice.Text == "" {
+		if choice.Number < 1 || choice.Number > len(options) {
+			return interpreter.ChoiceOption{}, false
+		}
+		return options[choice.Number-1], true
+	}
+
+	for _, option := range options {
+		if option.Text == choice.Text {
+			return option, true
+		}
+	}
+	return interpreter.ChoiceOption{}, false
+}
+
+func findResponse(responses []ToolResponse, function string, arguments []interface{}) (interface{}, bool) {
+	for _, response := range responses {
+		if response.Matches(function, arguments) {
+			return response.Result, true
+		}
+	}
+	return nil, false
+}
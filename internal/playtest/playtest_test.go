@@ -0,0 +1,21 @@
+package playtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoopWithoutPauseFails(t *testing.T) {
+	dir := t.TempDir()
+	script := "LABEL a\nLET x = 1\nGOTO a\n"
+	if err := os.WriteFile(filepath.Join(dir, "loop.q"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Run(filepath.Join(dir, "loop.test.json"), &Test{Script: "loop.q"})
+	if len(result.Failures) != 1 || !strings.Contains(result.Failures[0], "without a pause") {
+		t.Errorf("got failures %q, want the script to stop at the step limit", result.Failures)
+	}
+}
@@ -1,15 +1,16 @@
 package scanner
 
-func (scanner *Scanner) isDigit(c byte) bool {
+import "unicode"
+
+func (scanner *Scanner) isDigit(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
-func (scanner *Scanner) isAlpha(c byte) bool {
-	return (c >= 'a' && c <= 'z') ||
-		(c >= 'A' && c <= 'Z') ||
-		c == '_'
+// isAlpha accepts letters of any script, so names such as ŁUKASZ or 花子 are identifiers
+func (scanner *Scanner) isAlpha(c rune) bool {
+	return unicode.IsLetter(c) || c == '_'
 }
 
-func (scanner *Scanner) isAlphaNumeric(c byte) bool {
-	return scanner.isAlpha(c) || scanner.isDigit(c)
+func (scanner *Scanner) isAlphaNumeric(c rune) bool {
+	return scanner.isAlpha(c) || unicode.IsDigit(c) || unicode.IsMark(c)
 }
@@ -1,49 +1,124 @@
 package scanner
 
-import "quill/internal/token"
+import (
+	"quill/internal/token"
+	"unicode/utf8"
+)
 
 func (scanner *Scanner) scanString() *ScannerError {
 	toolCallDepth := 0
+	braceDepth := 0
+	inInnerString := false
+	var escapeErr *ScannerError
 
-	for scanner.peek() != '"' || toolCallDepth > 0 {
+	for scanner.peek() != '"' || toolCallDepth > 0 || braceDepth > 0 || inInnerString {
 		if scanner.isAtEnd() {
-			return &ScannerError{
-				Line:    scanner.line,
-				Message: "Unterminated string.",
-			}
+			return scanner.unterminated("Unterminated string.")
 		}
 
 		char := scanner.peek()
 
-		// Handle tool call nesting
-		if char == '<' {
-			toolCallDepth++
-		} else if char == '>' && toolCallDepth > 0 {
-			toolCallDepth--
-		} else if char == '"' && toolCallDepth > 0 {
-			// This is a quote inside a tool call, just advance past it
+		// Escape sequences are kept as they are, the parser decodes them
+		if char == '\\' {
+			if err := scanner.scanEscape(); err != nil && escapeErr == nil {
+				escapeErr = err
+			}
+			continue
+		}
+
+		// Strings inside an interpolation or tool call, such as {name ?? "stranger"}, may contain anything
+		if inInnerString {
+			if char == '"' {
+				inInnerString = false
+			}
 			scanner.advance()
 			continue
 		}
 
-		if char == '\n' {
-			scanner.line++
+		// Handle interpolation and tool call nesting. A '{' or '<' without its
+		// closing character on the same line is plain text, and a '<' only
+		// starts a tool call when a name follows, so "a < b" is too.
+		if char == '{' && scanner.closedOnLine('{', '}') {
+			braceDepth++
+		} else if char == '}' && braceDepth > 0 {
+			braceDepth--
+		} else if char == '"' && (braceDepth > 0 || toolCallDepth > 0) {
+			inInnerString = true
+		} else if char == '<' && braceDepth == 0 && scanner.isAlpha(scanner.peekNext()) && scanner.closedOnLine('<', '>') {
+			toolCallDepth++
+		} else if char == '>' && toolCallDepth > 0 && braceDepth == 0 {
+			toolCallDepth--
 		}
+
 		scanner.advance()
 	}
 
 	if scanner.isAtEnd() {
-		return &ScannerError{
-			Line:    scanner.line,
-			Message: "Unterminated string.",
-		}
+		return scanner.unterminated("Unterminated string.")
 	}
 
 	scanner.advance() // consume closing quote
 
 	value := scanner.source[scanner.start+1 : scanner.current-1]
 	scanner.addTokenWithLiteral(token.STRING, string(value))
-	return nil
+	return escapeErr
+}
+
+// closedOnLine reports whether the open character at the current position is
+// closed before the end of the line, skipping quoted strings. Braces nest, a
+// tool call ends at the first '>' like in the parser.
+func (scanner *Scanner) closedOnLine(open rune, close rune) bool {
+	depth := 0
+	inString := false
+
+	for offset := scanner.current + 1; offset < len(scanner.source); {
+		char, size := utf8.DecodeRuneInString(scanner.source[offset:])
+		offset += size
+
+		switch {
+		case char == '\n':
+			return false
+		case char == '\\':
+			_, size = utf8.DecodeRuneInString(scanner.source[offset:])
+			offset += size
+		case inString:
+			inString = char != '"'
+		case char == '"':
+			inString = true
+		case char == '{' && open == '{':
+			depth++
+		case char == close:
+			if depth == 0 {
+				return true
+			}
+			depth--
+		}
+	}
+
+	return false
+}
+
+// scanEscape skips the escape sequence at the current backslash and reports
+// it if it is not one of \" \\ \n \t \{ \<
+func (scanner *Scanner) scanEscape() *ScannerError {
+	line, column, offset := scanner.line, scanner.column, scanner.current
+	scanner.advance() // consume '\\'
+	if scanner.isAtEnd() {
+		return nil
+	}
+
+	char := scanner.advance()
+	switch char {
+	case '"', '\\', 'n', 't', '{', '<':
+		return nil
+	}
+
+	return &ScannerError{
+		Line:    line,
+		Column:  column,
+		Offset:  offset,
+		Message: "Invalid escape sequence: \\" + string(char),
+	}
 }
 
 func (scanner *Scanner) scanNumber() {
@@ -51,8 +126,18 @@ func (scanner *Scanner) scanNumber() {
 		scanner.advance()
 	}
 
+	// A '.' followed by a digit makes the number a float
+	tokenType := token.INT
+	if scanner.peek() == '.' && scanner.isDigit(scanner.peekNext()) {
+		tokenType = token.FLOAT
+		scanner.advance() // consume '.'
+		for scanner.isDigit(scanner.peek()) {
+			scanner.advance()
+		}
+	}
+
 	value := scanner.source[scanner.start:scanner.current]
-	scanner.addTokenWithLiteral(token.INT, string(value))
+	scanner.addTokenWithLiteral(tokenType, string(value))
 }
 
 func (scanner *Scanner) scanIdentifier() {
@@ -74,19 +159,26 @@ func (scanner *Scanner) scanToolCall() *ScannerError {
 	// We're already past the '<' character
 	start := scanner.current - 1 // Include the '<' in the token
 
-	// Scan until we find the closing '>'
-	for !scanner.isAtEnd() && scanner.peek() != '>' {
-		if scanner.peek() == '\n' {
-			scanner.line++
+	// Scan until we find the closing '>', which may be part of a string argument
+	inString := false
+	var escapeErr *ScannerError
+	for !scanner.isAtEnd() && (scanner.peek() != '>' || inString) {
+		switch scanner.peek() {
+		case '"':
+			inString = !inString
+		case '\\':
+			if inString {
+				if err := scanner.scanEscape(); err != nil && escapeErr == nil {
+					escapeErr = err
+				}
+				continue
+			}
 		}
 		scanner.advance()
 	}
 
 	if scanner.isAtEnd() {
-		return &ScannerError{
-			Line:    scanner.line,
-			Message: "Unterminated tool call.",
-		}
+		return scanner.unterminated("Unterminated tool call.")
 	}
 
 	scanner.advance() // consume the '>'
@@ -94,5 +186,5 @@ func (scanner *Scanner) scanToolCall() *ScannerError {
 	// Extract the full tool call content including < and >
 	value := scanner.source[start:scanner.current]
 	scanner.addTokenWithLiteral(token.TOOL_CALL, string(value))
-	return nil
+	return escapeErr
 }
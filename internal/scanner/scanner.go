@@ -4,26 +4,43 @@ import "quill/internal/token"
 
 type ErrorReporter func(line int, message string)
 
+// Scanner reads the source one character (rune) at a time. Offsets are byte
+// offsets into the source, columns count characters from 1.
 type Scanner struct {
-	source  string
-	tokens  []token.Token
-	start   int
-	current int
-	line    int
+	source      string
+	file        string
+	tokens      []token.Token
+	start       int
+	current     int
+	line        int
+	column      int
+	startLine   int
+	startColumn int
 }
 
 type ScannerError struct {
+	File    string `json:"file,omitempty"`
 	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Offset  int    `json:"offset"`
 	Message string `json:"message"`
 }
 
 func New(source string) *Scanner {
+	return NewWithFile(source, "")
+}
+
+// NewWithFile creates a scanner that records the name of the source file in
+// every token and error
+func NewWithFile(source string, file string) *Scanner {
 	return &Scanner{
 		source:  source,
+		file:    file,
 		tokens:  make([]token.Token, 0),
 		start:   0,
 		current: 0,
 		line:    1,
+		column:  1,
 	}
 }
 
@@ -31,13 +48,20 @@ func (scanner *Scanner) ScanTokens() ([]token.Token, []ScannerError) {
 	var errors []ScannerError = make([]ScannerError, 0)
 	for !scanner.isAtEnd() {
 		scanner.start = scanner.current
+		scanner.startLine = scanner.line
+		scanner.startColumn = scanner.column
 		err := scanner.scanToken()
 		if err != nil {
+			err.File = scanner.file
 			errors = append(errors, *err)
 		}
 	}
 
-	scanner.tokens = append(scanner.tokens, token.NewToken(token.EOF, "", nil, scanner.line))
+	eof := token.NewToken(token.EOF, "", nil, scanner.line)
+	eof.Column = scanner.column
+	eof.Offset = len(scanner.source)
+	eof.File = scanner.file
+	scanner.tokens = append(scanner.tokens, eof)
 
 	return scanner.tokens, errors
 }
@@ -51,7 +75,6 @@ func (scanner *Scanner) scanToken() *ScannerError {
 
 	// Special Cases
 	case '\n':
-		scanner.line++
 		scanner.addToken(token.NEWLINE)
 
 	// Single Character
@@ -61,6 +84,8 @@ func (scanner *Scanner) scanToken() *ScannerError {
 		scanner.addToken(token.SEMICOLON)
 	case ',':
 		scanner.addToken(token.COMMA)
+	case '.':
+		scanner.addToken(token.DOT)
 	case '(':
 		scanner.addToken(token.LPAREN)
 	case ')':
@@ -94,6 +119,12 @@ func (scanner *Scanner) scanToken() *ScannerError {
 		} else {
 			scanner.addToken(token.MINUS)
 		}
+	case '*':
+		scanner.addToken(token.STAR)
+	case '/':
+		scanner.addToken(token.SLASH)
+	case '%':
+		scanner.addToken(token.PERCENT)
 	case '>':
 		if scanner.peek() == '=' {
 			scanner.advance()
@@ -130,7 +161,11 @@ func (scanner *Scanner) scanToken() *ScannerError {
 		if scanner.peek() == '|' {
 			scanner.advance()
 			scanner.addToken(token.OR)
+		} else {
+			scanner.addToken(token.PIPE)
 		}
+	case '~':
+		scanner.addToken(token.TILDE)
 	case '?':
 		if scanner.peek() == '?' {
 			scanner.advance()
@@ -169,10 +204,7 @@ func (scanner *Scanner) scanToken() *ScannerError {
 
 		// Handle unexpected characters
 		scanner.addToken(token.ILLEGAL)
-		return &ScannerError{
-			Line:    scanner.line,
-			Message: "Unexpected character: " + string(char),
-		}
+		return scanner.errorAtStart("Unexpected character: " + string(char))
 	}
 
 	return nil
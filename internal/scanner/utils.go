@@ -1,10 +1,21 @@
 package scanner
 
-import "quill/internal/token"
+import (
+	"quill/internal/token"
+	"unicode/utf8"
+)
 
-func (scanner *Scanner) advance() byte {
-	scanner.current++
-	return scanner.source[scanner.current-1]
+func (scanner *Scanner) advance() rune {
+	char, size := utf8.DecodeRuneInString(scanner.source[scanner.current:])
+	scanner.current += size
+
+	if char == '\n' {
+		scanner.line++
+		scanner.column = 1
+	} else {
+		scanner.column++
+	}
+	return char
 }
 
 func (scanner *Scanner) addToken(tokenType token.TokenType) {
@@ -13,31 +24,59 @@ func (scanner *Scanner) addToken(tokenType token.TokenType) {
 
 func (scanner *Scanner) addTokenWithLiteral(tokenType token.TokenType, literal interface{}) {
 	text := scanner.source[scanner.start:scanner.current]
-	scanner.tokens = append(scanner.tokens, token.NewToken(tokenType, string(text), literal, scanner.line))
+	newToken := token.NewToken(tokenType, string(text), literal, scanner.startLine)
+	newToken.Column = scanner.startColumn
+	newToken.Offset = scanner.start
+	newToken.File = scanner.file
+	scanner.tokens = append(scanner.tokens, newToken)
+}
+
+// errorAtStart reports an error at the first character of the current token
+func (scanner *Scanner) errorAtStart(message string) *ScannerError {
+	return &ScannerError{
+		Line:    scanner.startLine,
+		Column:  scanner.startColumn,
+		Offset:  scanner.start,
+		Message: message,
+	}
+}
+
+// unterminated reports a string or tool call that runs to the end of the
+// source. It is kept as an ILLEGAL token, so the parser does not report the
+// missing value again.
+func (scanner *Scanner) unterminated(message string) *ScannerError {
+	scanner.addToken(token.ILLEGAL)
+	return scanner.errorAtStart(message)
 }
 
 func (scanner *Scanner) isAtEnd() bool {
 	return scanner.current >= len(scanner.source)
 }
 
-func (scanner *Scanner) match(expected byte) bool {
-	if scanner.isAtEnd() || scanner.source[scanner.current] != expected {
+func (scanner *Scanner) match(expected rune) bool {
+	if scanner.isAtEnd() || scanner.peek() != expected {
 		return false
 	}
-	scanner.current++
+	scanner.advance()
 	return true
 }
 
-func (scanner *Scanner) peek() byte {
+func (scanner *Scanner) peek() rune {
 	if scanner.isAtEnd() {
 		return 0
 	}
-	return scanner.source[scanner.current]
+	char, _ := utf8.DecodeRuneInString(scanner.source[scanner.current:])
+	return char
 }
 
-func (scanner *Scanner) peekNext() byte {
-	if scanner.current+1 >= len(scanner.source) {
+func (scanner *Scanner) peekNext() rune {
+	if scanner.isAtEnd() {
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(scanner.source[scanner.current:])
+	if scanner.current+size >= len(scanner.source) {
 		return 0
 	}
-	return scanner.source[scanner.current+1]
+	char, _ := utf8.DecodeRuneInString(scanner.source[scanner.current+size:])
+	return char
 }
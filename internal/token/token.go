@@ -5,6 +5,9 @@ type Token struct {
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	Column  int    // Column of the first character, counted in characters from 1
+	Offset  int    // Byte offset of the first character in the source
+	File    string // Name of the source file, empty when scanning a plain string
 }
 
 func NewToken(tokenType TokenType, lexeme string, literal interface{}, line int) Token {
@@ -13,12 +13,14 @@ const (
 const (
 	IDENT   TokenType = "IDENT"   // Identifiers, used for variable names, function names, etc.
 	INT     TokenType = "INT"     // Integer literals
+	FLOAT   TokenType = "FLOAT"   // Floating-point literals
 	STRING  TokenType = "STRING"  // String literals
 	COMMENT TokenType = "COMMENT" // Comments in the source code
 
 	// Structural
 	COLON         TokenType = ":"
 	COMMA         TokenType = ","
+	DOT           TokenType = "."
 	SEMICOLON     TokenType = ";"
 	LPAREN        TokenType = "("
 	RPAREN        TokenType = ")"
@@ -32,8 +34,12 @@ const (
 	MINUS         TokenType = "-"
 	MINUS_ASSIGN  TokenType = "-="
 	STAR          TokenType = "*"
+	SLASH         TokenType = "/"
+	PERCENT       TokenType = "%"
 	ARROW         TokenType = "->"
 	QUESTION      TokenType = "?"
+	TILDE         TokenType = "~"
+	PIPE          TokenType = "|"
 	EQ            TokenType = "=="
 	NE            TokenType = "!="
 	GT            TokenType = ">"
@@ -49,31 +55,62 @@ const (
 
 // Keywords
 const (
-	SCENE  TokenType = "SCENE"  // Unused keyword
+	SCENE  TokenType = "SCENE"  // Scene keyword, used to define a named dialog that can be called
+	CALL   TokenType = "CALL"   // Call keyword, used to run a scene and come back afterwards
+	RETURN TokenType = "RETURN" // Return keyword, used to leave a scene before its end
 	RANDOM TokenType = "RANDOM" // Random keyword, used to indicate a random choice in the script
 	GOTO   TokenType = "GOTO"   // Goto keyword, used for jumping to a label in the script
 	LABEL  TokenType = "LABEL"  // Label keyword, used to define a label for goto statements
 	CHOICE TokenType = "CHOICE" // Choice keyword, used to define a choice in the script
 	END    TokenType = "END"    // End keyword, used to indicate the end of a script or block
 
+	INCLUDE TokenType = "INCLUDE" // Include keyword, used to run another file at this point in the script
+
+	// Sequence keywords
+	CYCLE    TokenType = "CYCLE"    // Cycle keyword, used for a sequence that starts over after the last option
+	STOPPING TokenType = "STOPPING" // Stopping keyword, used for a sequence that repeats its last option
+	SHUFFLE  TokenType = "SHUFFLE"  // Shuffle keyword, used for a sequence that runs every option once in random order before repeating
+
+	// Choice option keywords
+	ONCE   TokenType = "ONCE"   // Once keyword, used for choice options that disappear after being chosen and for sequences that run each option once
+	AS     TokenType = "AS"     // As keyword, used to name a choice option
+	VISITS TokenType = "VISITS" // Visits keyword, used to read how often a label was reached or a named option was chosen
+	TURNS  TokenType = "TURNS"  // Turns keyword, used to read how many choices have been made
+
 	// Variable and logic keywords
 	LET   TokenType = "LET"   // Let keyword, used to define a variable
 	IF    TokenType = "IF"    // If keyword, used for conditional statements
 	ELSE  TokenType = "ELSE"  // Else keyword, used for alternative paths in conditional statements
+	MATCH TokenType = "MATCH" // Match keyword, used to branch on the value of an expression
+	FOR   TokenType = "FOR"   // For keyword, used to run a block for every item of a list or map
+	IN    TokenType = "IN"    // In keyword, used to test membership and in FOR loops
 	TRUE  TokenType = "TRUE"  // True keyword, used for boolean true values
 	FALSE TokenType = "FALSE" // False keyword, used for boolean false values
 )
 
 var Keywords = map[string]TokenType{
-	"SCENE":  SCENE,
-	"RANDOM": RANDOM,
-	"GOTO":   GOTO,
-	"LABEL":  LABEL,
-	"CHOICE": CHOICE,
-	"END":    END,
-	"LET":    LET,
-	"IF":     IF,
-	"ELSE":   ELSE,
-	"TRUE":   TRUE,
-	"FALSE":  FALSE,
+	"SCENE":    SCENE,
+	"CALL":     CALL,
+	"RETURN":   RETURN,
+	"RANDOM":   RANDOM,
+	"GOTO":     GOTO,
+	"LABEL":    LABEL,
+	"CHOICE":   CHOICE,
+	"END":      END,
+	"INCLUDE":  INCLUDE,
+	"ONCE":     ONCE,
+	"CYCLE":    CYCLE,
+	"STOPPING": STOPPING,
+	"SHUFFLE":  SHUFFLE,
+	"AS":       AS,
+	"VISITS":   VISITS,
+	"TURNS":    TURNS,
+	"LET":      LET,
+	"IF":       IF,
+	"ELSE":     ELSE,
+	"MATCH":    MATCH,
+	"FOR":      FOR,
+	"IN":       IN,
+	"TRUE":     TRUE,
+	"FALSE":    FALSE,
 }